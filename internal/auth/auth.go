@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingToken is returned when a request carries no bearer token
+	ErrMissingToken = errors.New("missing bearer token")
+	// ErrInvalidToken is returned when a token fails signature or claim validation
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Identity is the authenticated caller extracted from a verified token
+type Identity struct {
+	Subject  string
+	TenantID int64
+	Roles    []string
+	// Plan is the tenant's subscription plan, if the token names one
+	Plan string
+}
+
+type contextKey string
+
+const identityKey contextKey = "identity"
+
+// FromContext extracts the authenticated identity from context
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey).(Identity)
+	return identity, ok
+}
+
+// WithIdentity adds the authenticated identity to context
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// TokenFromRequest extracts the bearer token from the Authorization header
+func TokenFromRequest(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingToken
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", ErrMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// Config holds token verification configuration
+type Config struct {
+	// HMACSecret enables HS256 tokens signed with a shared secret
+	HMACSecret string
+	// JWKSFile and JWKSURL provide RS256 (and optionally HS256 "oct") keys
+	JWKSFile string
+	JWKSURL  string
+	// JWKSRefreshInterval controls how often a remote key set is refetched
+	JWKSRefreshInterval time.Duration
+
+	Issuer   string
+	Audience string
+	// TenantClaim names the claim carrying the numeric tenant ID
+	TenantClaim string
+	// RolesClaim names the claim carrying the caller's roles
+	RolesClaim string
+	// PlanClaim names the claim carrying the tenant's plan
+	PlanClaim string
+	// Leeway tolerates clock skew when checking exp and nbf
+	Leeway time.Duration
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefetchInterval limits how often an unknown key ID may trigger a refetch
+const minRefetchInterval = 30 * time.Second
+
+// jwksFetchTimeout bounds each fetch of a remote JWKS document
+const jwksFetchTimeout = 10 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// keySet holds verification keys indexed by key ID
+type keySet struct {
+	rsa  map[string]*rsa.PublicKey
+	hmac map[string][]byte
+}
+
+func parseKeySet(data []byte) (*keySet, error) {
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := &keySet{
+		rsa:  make(map[string]*rsa.PublicKey),
+		hmac: make(map[string][]byte),
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			pub, err := parseRSAKey(k)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse RSA key %q: %w", k.Kid, err)
+			}
+			keys.rsa[k.Kid] = pub
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse oct key %q: %w", k.Kid, err)
+			}
+			keys.hmac[k.Kid] = secret
+		}
+	}
+	return keys, nil
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("unsupported exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// lookup finds a key by ID; an empty ID matches when the set holds a single key
+func lookup[K any](keys map[string]K, kid string) (K, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	var zero K
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return zero, false
+}
+
+func loadKeySetFile(path string) (*keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	return parseKeySet(data)
+}
+
+// remoteKeySet fetches a JWKS document over HTTP and keeps it fresh
+type remoteKeySet struct {
+	url             string
+	refreshInterval time.Duration
+	httpClient      *http.Client
+
+	mu          sync.Mutex
+	keys        *keySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// fetching is closed when the fetch in flight finishes; nil when there
+	// is none
+	fetching chan struct{}
+}
+
+func newRemoteKeySet(ctx context.Context, url string, refreshInterval time.Duration) (*remoteKeySet, error) {
+	if refreshInterval <= 0 {
+		refreshInterval = 15 * time.Minute
+	}
+	r := &remoteKeySet{
+		url:             url,
+		refreshInterval: refreshInterval,
+		httpClient:      &http.Client{Timeout: jwksFetchTimeout},
+	}
+	keys, err := r.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.keys, r.fetchedAt, r.attemptedAt = keys, time.Now(), time.Now()
+	return r, nil
+}
+
+// get returns the current key set, refetching it when stale or when kid is
+// unknown (key rotation), but never more often than minRefetchInterval.
+// Only callers that need an unknown key wait for the refetch, and only
+// until ctx is done; the others are served the keys already held.
+func (r *remoteKeySet) get(ctx context.Context, kid string, hasKey func(*keySet) bool) *keySet {
+	r.mu.Lock()
+	keys := r.keys
+	stale := time.Since(r.fetchedAt) > r.refreshInterval
+	unknown := !hasKey(keys)
+	if r.fetching == nil && (stale || unknown) && time.Since(r.attemptedAt) > minRefetchInterval {
+		r.startFetchLocked()
+	}
+	fetching := r.fetching
+	r.mu.Unlock()
+
+	if !unknown || fetching == nil {
+		return keys
+	}
+	select {
+	case <-fetching:
+	case <-ctx.Done():
+		return keys
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.keys
+}
+
+// startFetchLocked refetches the key set in the background. The fetch is
+// shared by every caller and does not depend on any of their contexts.
+// Failures keep the previous keys.
+func (r *remoteKeySet) startFetchLocked() {
+	fetching := make(chan struct{})
+	r.fetching = fetching
+	r.attemptedAt = time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+		defer cancel()
+		keys, err := r.fetch(ctx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err != nil {
+			log.Printf("Error refreshing JWKS: %v", err)
+		} else {
+			r.keys, r.fetchedAt = keys, time.Now()
+		}
+		r.fetching = nil
+		close(fetching)
+	}()
+}
+
+func (r *remoteKeySet) fetch(ctx context.Context) (*keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	return parseKeySet(data)
+}
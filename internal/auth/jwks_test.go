@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	rsaKeysOnce sync.Once
+	rsaKeys     [2]*rsa.PrivateKey
+)
+
+// testRSAKey returns one of two RSA keys, generated once since generating
+// them is slow
+func testRSAKey(t *testing.T, i int) *rsa.PrivateKey {
+	t.Helper()
+	rsaKeysOnce.Do(func() {
+		for i := range rsaKeys {
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				panic(err)
+			}
+			rsaKeys[i] = key
+		}
+	})
+	return rsaKeys[i]
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jwk {
+	return jwk{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// jwksServer serves a JWKS document that tests can replace, and holds each
+// request until release is closed, if it is set
+type jwksServer struct {
+	*httptest.Server
+	set      atomic.Pointer[jwkSet]
+	release  atomic.Pointer[chan struct{}]
+	failing  atomic.Bool
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	t.Helper()
+	s := &jwksServer{}
+	s.set.Store(&jwkSet{Keys: keys})
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if release := s.release.Load(); release != nil {
+			<-*release
+		}
+		if s.failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(s.set.Load())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// hold makes requests wait until the returned func is called
+func (s *jwksServer) hold() func() {
+	release := make(chan struct{})
+	s.release.Store(&release)
+	return func() {
+		s.release.Store(nil)
+		close(release)
+	}
+}
+
+func newTestRemoteKeySet(t *testing.T, server *jwksServer) *remoteKeySet {
+	t.Helper()
+	r, err := newRemoteKeySet(context.Background(), server.URL, time.Hour)
+	if err != nil {
+		t.Fatalf("newRemoteKeySet: %v", err)
+	}
+	return r
+}
+
+// allowRefetch lets the next get refetch, as if minRefetchInterval had passed
+func (r *remoteKeySet) allowRefetch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attemptedAt = time.Time{}
+}
+
+func (r *remoteKeySet) waitForFetch(t *testing.T) {
+	t.Helper()
+	r.mu.Lock()
+	fetching := r.fetching
+	r.mu.Unlock()
+	if fetching == nil {
+		return
+	}
+	select {
+	case <-fetching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("JWKS fetch did not finish")
+	}
+}
+
+func hasRSAKey(kid string) func(*keySet) bool {
+	return func(k *keySet) bool {
+		_, ok := k.rsa[kid]
+		return ok
+	}
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("key-1", &testRSAKey(t, 0).PublicKey))
+	r := newTestRemoteKeySet(t, server)
+
+	server.set.Store(&jwkSet{Keys: []jwk{rsaJWK("key-2", &testRSAKey(t, 1).PublicKey)}})
+
+	// Unknown key IDs refetch at most once per minRefetchInterval
+	if keys := r.get(context.Background(), "key-2", hasRSAKey("key-2")); keys.rsa["key-2"] != nil {
+		t.Fatal("refetched within minRefetchInterval")
+	}
+	r.allowRefetch()
+	if keys := r.get(context.Background(), "key-2", hasRSAKey("key-2")); keys.rsa["key-2"] == nil {
+		t.Fatal("rotated key was not fetched")
+	}
+	if requests := server.requests.Load(); requests != 2 {
+		t.Fatalf("got %d JWKS requests, want 2", requests)
+	}
+}
+
+func TestRemoteKeySetSlowRefreshDoesNotBlock(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("key-1", &testRSAKey(t, 0).PublicKey))
+	r := newTestRemoteKeySet(t, server)
+	release := server.hold()
+
+	// A stale key set is refreshed in the background
+	r.mu.Lock()
+	r.fetchedAt = time.Now().Add(-2 * time.Hour)
+	r.mu.Unlock()
+	r.allowRefetch()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if keys := r.get(context.Background(), "key-1", hasRSAKey("key-1")); keys.rsa["key-1"] == nil {
+			t.Error("known key was not served")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("get waited for the refresh of a known key")
+	}
+	release()
+	r.waitForFetch(t)
+}
+
+func TestRemoteKeySetCanceledCallerDoesNotAbortRefresh(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("key-1", &testRSAKey(t, 0).PublicKey))
+	r := newTestRemoteKeySet(t, server)
+	release := server.hold()
+	server.set.Store(&jwkSet{Keys: []jwk{rsaJWK("key-2", &testRSAKey(t, 1).PublicKey)}})
+	r.allowRefetch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if keys := r.get(ctx, "key-2", hasRSAKey("key-2")); keys.rsa["key-2"] != nil {
+		t.Fatal("got the rotated key before the fetch finished")
+	}
+
+	release()
+	r.waitForFetch(t)
+	if keys := r.get(context.Background(), "key-2", hasRSAKey("key-2")); keys.rsa["key-2"] == nil {
+		t.Fatal("refresh was aborted with the caller's request")
+	}
+}
+
+func TestRemoteKeySetFailedRefreshKeepsKeys(t *testing.T) {
+	server := newJWKSServer(t, rsaJWK("key-1", &testRSAKey(t, 0).PublicKey))
+	r := newTestRemoteKeySet(t, server)
+	fetchedAt := r.fetchedAt
+
+	server.failing.Store(true)
+	r.allowRefetch()
+	keys := r.get(context.Background(), "key-2", hasRSAKey("key-2"))
+	if keys.rsa["key-1"] == nil {
+		t.Fatal("failed refresh dropped the previous keys")
+	}
+	if !r.fetchedAt.Equal(fetchedAt) {
+		t.Fatal("failed refresh moved fetchedAt")
+	}
+}
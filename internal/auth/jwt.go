@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Verifier validates signed JWTs and extracts the caller's identity
+type Verifier struct {
+	config Config
+	secret []byte
+	static *keySet
+	remote *remoteKeySet
+}
+
+// NewVerifier creates a verifier from configuration, loading any JWKS up front
+func NewVerifier(ctx context.Context, config Config) (*Verifier, error) {
+	if config.HMACSecret == "" && config.JWKSFile == "" && config.JWKSURL == "" {
+		return nil, errors.New("no token verification keys configured")
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant_id"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	if config.PlanClaim == "" {
+		config.PlanClaim = "plan"
+	}
+
+	v := &Verifier{config: config}
+	if config.HMACSecret != "" {
+		v.secret = []byte(config.HMACSecret)
+	}
+	if config.JWKSFile != "" {
+		keys, err := loadKeySetFile(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.static = keys
+	}
+	if config.JWKSURL != "" {
+		remote, err := newRemoteKeySet(ctx, config.JWKSURL, config.JWKSRefreshInterval)
+		if err != nil {
+			return nil, err
+		}
+		v.remote = remote
+	}
+	return v, nil
+}
+
+// Verify checks the token signature and standard claims and returns the identity
+func (v *Verifier) Verify(ctx context.Context, token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("%w: bad header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: bad signature encoding", ErrInvalidToken)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+
+	if err := v.verifySignature(ctx, header, signingInput, signature); err != nil {
+		return Identity{}, err
+	}
+
+	var claims map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("%w: bad claims: %v", ErrInvalidToken, err)
+	}
+	return v.identityFromClaims(claims)
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, header tokenHeader, signingInput, signature []byte) error {
+	switch header.Alg {
+	case "HS256":
+		secret, ok := v.hmacKey(ctx, header.Kid)
+		if !ok {
+			return fmt.Errorf("%w: no HS256 key for kid %q", ErrInvalidToken, header.Kid)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+		return nil
+	case "RS256":
+		pub, ok := v.rsaKey(ctx, header.Kid)
+		if !ok {
+			return fmt.Errorf("%w: no RS256 key for kid %q", ErrInvalidToken, header.Kid)
+		}
+		digest := sha256.Sum256(signingInput)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+}
+
+func (v *Verifier) hmacKey(ctx context.Context, kid string) ([]byte, bool) {
+	if v.static != nil {
+		if key, ok := lookup(v.static.hmac, kid); ok {
+			return key, true
+		}
+	}
+	if v.remote != nil {
+		keys := v.remote.get(ctx, kid, func(k *keySet) bool {
+			_, ok := lookup(k.hmac, kid)
+			return ok
+		})
+		if key, ok := lookup(keys.hmac, kid); ok {
+			return key, true
+		}
+	}
+	if v.secret != nil && kid == "" {
+		return v.secret, true
+	}
+	return nil, false
+}
+
+func (v *Verifier) rsaKey(ctx context.Context, kid string) (*rsa.PublicKey, bool) {
+	if v.static != nil {
+		if key, ok := lookup(v.static.rsa, kid); ok {
+			return key, true
+		}
+	}
+	if v.remote != nil {
+		keys := v.remote.get(ctx, kid, func(k *keySet) bool {
+			_, ok := lookup(k.rsa, kid)
+			return ok
+		})
+		return lookup(keys.rsa, kid)
+	}
+	return nil, false
+}
+
+func (v *Verifier) identityFromClaims(claims map[string]json.RawMessage) (Identity, error) {
+	now := time.Now()
+
+	exp, ok, err := numericClaim(claims, "exp")
+	if err != nil || !ok {
+		return Identity{}, fmt.Errorf("%w: missing or invalid exp", ErrInvalidToken)
+	}
+	if now.After(time.Unix(exp, 0).Add(v.config.Leeway)) {
+		return Identity{}, fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok, err := numericClaim(claims, "nbf"); err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid nbf", ErrInvalidToken)
+	} else if ok && now.Add(v.config.Leeway).Before(time.Unix(nbf, 0)) {
+		return Identity{}, fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+
+	if v.config.Issuer != "" {
+		var iss string
+		if err := json.Unmarshal(claims["iss"], &iss); err != nil || iss != v.config.Issuer {
+			return Identity{}, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if v.config.Audience != "" && !hasAudience(claims["aud"], v.config.Audience) {
+		return Identity{}, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	var subject string
+	if err := json.Unmarshal(claims["sub"], &subject); err != nil || subject == "" {
+		return Identity{}, fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+
+	tenantID, ok, err := numericClaim(claims, v.config.TenantClaim)
+	if err != nil || !ok || tenantID <= 0 {
+		return Identity{}, fmt.Errorf("%w: missing or invalid %s", ErrInvalidToken, v.config.TenantClaim)
+	}
+
+	// An unreadable plan is ignored; the default plan applies
+	var plan string
+	json.Unmarshal(claims[v.config.PlanClaim], &plan)
+
+	return Identity{
+		Subject:  subject,
+		TenantID: tenantID,
+		Roles:    stringListClaim(claims[v.config.RolesClaim]),
+		Plan:     plan,
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// numericClaim reads an integer claim encoded either as a JSON number or a
+// numeric string; ok is false when the claim is absent
+func numericClaim(claims map[string]json.RawMessage, name string) (value int64, ok bool, err error) {
+	raw, present := claims[name]
+	if !present || string(raw) == "null" {
+		return 0, false, nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(raw, &number); err != nil {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return 0, true, err
+		}
+		number = json.Number(s)
+	}
+	if value, err = number.Int64(); err == nil {
+		return value, true, nil
+	}
+	// exp/nbf may legally carry fractional seconds
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return 0, true, err
+	}
+	if name == "exp" || name == "nbf" {
+		return int64(f), true, nil
+	}
+	return 0, true, fmt.Errorf("claim %s is not an integer", name)
+}
+
+// stringListClaim reads a claim encoded either as an array of strings or a
+// space-delimited string (as in the OAuth scope claim)
+func stringListClaim(raw json.RawMessage) []string {
+	var many []string
+	if err := json.Unmarshal(raw, &many); err == nil {
+		return many
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return strings.Fields(single)
+	}
+	return nil
+}
+
+// hasAudience matches aud encoded either as a string or an array of strings
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+	var many []string
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return false
+	}
+	for _, aud := range many {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
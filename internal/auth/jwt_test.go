@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signedToken builds a token with the given header, signing it with sign
+func signedToken(t *testing.T, header, claims map[string]interface{}, sign func(signingInput []byte) []byte) string {
+	t.Helper()
+	signingInput := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}
+}
+
+func rs256(t *testing.T, key *rsa.PrivateKey) func([]byte) []byte {
+	return func(signingInput []byte) []byte {
+		digest := sha256.Sum256(signingInput)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return signature
+	}
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":       "user-1",
+		"tenant_id": 7,
+		"roles":     []string{"editor"},
+		"iss":       "https://issuer.example",
+		"aud":       "api",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// withClaims returns validClaims with some claims replaced, or removed if nil
+func withClaims(changes map[string]interface{}) map[string]interface{} {
+	claims := validClaims()
+	for name, value := range changes {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// writeJWKS writes a JWKS file holding keys
+func writeJWKS(t *testing.T, keys ...jwk) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	data, _ := json.Marshal(jwkSet{Keys: keys})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write JWKS: %v", err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey := testRSAKey(t, 0)
+	otherKey := testRSAKey(t, 1)
+	verifier, err := NewVerifier(context.Background(), Config{
+		HMACSecret: testSecret,
+		JWKSFile:   writeJWKS(t, rsaJWK("rsa-1", &rsaKey.PublicKey)),
+		Issuer:     "https://issuer.example",
+		Audience:   "api",
+		Leeway:     30 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	hsHeader := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	rsHeader := map[string]interface{}{"alg": "RS256", "kid": "rsa-1"}
+	now := time.Now()
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"HS256", signedToken(t, hsHeader, validClaims(), hs256([]byte(testSecret))), false},
+		{"RS256", signedToken(t, rsHeader, validClaims(), rs256(t, rsaKey)), false},
+		{"string tenant ID", signedToken(t, hsHeader, withClaims(map[string]interface{}{"tenant_id": "7"}), hs256([]byte(testSecret))), false},
+		{"audience list", signedToken(t, hsHeader, withClaims(map[string]interface{}{"aud": []string{"other", "api"}}), hs256([]byte(testSecret))), false},
+		{"expired within leeway", signedToken(t, hsHeader, withClaims(map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}), hs256([]byte(testSecret))), false},
+
+		{"wrong secret", signedToken(t, hsHeader, validClaims(), hs256([]byte("other"))), true},
+		{"RS256 signed by another key", signedToken(t, rsHeader, validClaims(), rs256(t, otherKey)), true},
+		{"unknown kid", signedToken(t, map[string]interface{}{"alg": "RS256", "kid": "rsa-2"}, validClaims(), rs256(t, rsaKey)), true},
+		{"alg none", signedToken(t, map[string]interface{}{"alg": "none"}, validClaims(), func([]byte) []byte { return nil }), true},
+		{"alg none uppercase", signedToken(t, map[string]interface{}{"alg": "NONE"}, validClaims(), func([]byte) []byte { return nil }), true},
+		{"unsupported alg", signedToken(t, map[string]interface{}{"alg": "HS512"}, validClaims(), hs256([]byte(testSecret))), true},
+		{"expired", signedToken(t, hsHeader, withClaims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}), hs256([]byte(testSecret))), true},
+		{"missing exp", signedToken(t, hsHeader, withClaims(map[string]interface{}{"exp": nil}), hs256([]byte(testSecret))), true},
+		{"not yet valid", signedToken(t, hsHeader, withClaims(map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}), hs256([]byte(testSecret))), true},
+		{"wrong issuer", signedToken(t, hsHeader, withClaims(map[string]interface{}{"iss": "https://evil.example"}), hs256([]byte(testSecret))), true},
+		{"wrong audience", signedToken(t, hsHeader, withClaims(map[string]interface{}{"aud": "other"}), hs256([]byte(testSecret))), true},
+		{"missing subject", signedToken(t, hsHeader, withClaims(map[string]interface{}{"sub": nil}), hs256([]byte(testSecret))), true},
+		{"missing tenant", signedToken(t, hsHeader, withClaims(map[string]interface{}{"tenant_id": nil}), hs256([]byte(testSecret))), true},
+		{"zero tenant", signedToken(t, hsHeader, withClaims(map[string]interface{}{"tenant_id": 0}), hs256([]byte(testSecret))), true},
+		{"malformed", "not-a-token", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyTamperedClaims(t *testing.T) {
+	verifier, err := NewVerifier(context.Background(), Config{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	token := signedToken(t, map[string]interface{}{"alg": "HS256"}, validClaims(), hs256([]byte(testSecret)))
+
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + encodeSegment(t, withClaims(map[string]interface{}{"tenant_id": 8})) + "." + parts[2]
+	if _, err := verifier.Verify(context.Background(), tampered); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+// TestVerifyAlgorithmConfusion signs an HS256 token with the RSA public key
+// as the HMAC secret; it must not verify against the RSA key
+func TestVerifyAlgorithmConfusion(t *testing.T) {
+	rsaKey := testRSAKey(t, 0)
+	verifier, err := NewVerifier(context.Background(), Config{
+		JWKSFile: writeJWKS(t, rsaJWK("rsa-1", &rsaKey.PublicKey)),
+	})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	for _, secret := range [][]byte{der, rsaKey.PublicKey.N.Bytes()} {
+		token := signedToken(t, map[string]interface{}{"alg": "HS256", "kid": "rsa-1"}, validClaims(), hs256(secret))
+		if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("err = %v, want ErrInvalidToken", err)
+		}
+	}
+}
+
+func TestVerifyIdentity(t *testing.T) {
+	verifier, err := NewVerifier(context.Background(), Config{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	claims := withClaims(map[string]interface{}{"roles": "viewer inventory-clerk", "plan": "pro"})
+	token := signedToken(t, map[string]interface{}{"alg": "HS256"}, claims, hs256([]byte(testSecret)))
+
+	identity, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if identity.Subject != "user-1" || identity.TenantID != 7 || identity.Plan != "pro" || len(identity.Roles) != 2 {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if !identity.HasPermission(PermissionInventoryWrite) || identity.HasPermission(PermissionItemsWrite) {
+		t.Fatal("unexpected permissions")
+	}
+}
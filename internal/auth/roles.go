@@ -0,0 +1,40 @@
+package auth
+
+// Permission is an action a caller may perform on the API
+type Permission string
+
+const (
+	PermissionItemsRead      Permission = "items:read"
+	PermissionItemsWrite     Permission = "items:write"
+	PermissionInventoryWrite Permission = "inventory:write"
+)
+
+// Roles recognised in the token's roles claim
+const (
+	RoleViewer         = "viewer"
+	RoleEditor         = "editor"
+	RoleInventoryClerk = "inventory-clerk"
+	RoleAdmin          = "admin"
+)
+
+// rolePermissions grants permissions per role; admin is granted everything
+var rolePermissions = map[string][]Permission{
+	RoleViewer:         {PermissionItemsRead},
+	RoleEditor:         {PermissionItemsRead, PermissionItemsWrite, PermissionInventoryWrite},
+	RoleInventoryClerk: {PermissionItemsRead, PermissionInventoryWrite},
+}
+
+// HasPermission reports whether any of the identity's roles grants the permission
+func (i Identity) HasPermission(permission Permission) bool {
+	for _, role := range i.Roles {
+		if role == RoleAdmin {
+			return true
+		}
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     func(c *LRU[string, int])
+		present []string
+		absent  []string
+	}{
+		{
+			name: "evicts least recently added",
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1)
+				c.Add("b", 2)
+				c.Add("c", 3)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+		},
+		{
+			name: "get refreshes recency",
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1)
+				c.Add("b", 2)
+				c.Get("a")
+				c.Add("c", 3)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name: "replacing refreshes recency",
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1)
+				c.Add("b", 2)
+				c.Add("a", 10)
+				c.Add("c", 3)
+			},
+			present: []string{"a", "c"},
+			absent:  []string{"b"},
+		},
+		{
+			name: "remove frees a slot",
+			ops: func(c *LRU[string, int]) {
+				c.Add("a", 1)
+				c.Add("b", 2)
+				c.Remove("a")
+				c.Add("c", 3)
+			},
+			present: []string{"b", "c"},
+			absent:  []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](2, time.Hour)
+			tt.ops(c)
+			for _, key := range tt.present {
+				if _, ok := c.Get(key); !ok {
+					t.Errorf("%s was evicted", key)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := c.Get(key); ok {
+					t.Errorf("%s is still cached", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUReplaceValue(t *testing.T) {
+	c := New[string, int](2, time.Hour)
+	c.Add("a", 1)
+	c.Add("a", 2)
+	if value, ok := c.Get("a"); !ok || value != 2 {
+		t.Fatalf("Get = %d, %v, want 2", value, ok)
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	c := New[string, int](2, 10*time.Millisecond)
+	c.Add("a", 1)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("entry expired early")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("expired entry was served")
+	}
+	// The expired entry no longer takes up a slot
+	c.Add("b", 2)
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); !ok {
+		t.Fatal("b was evicted")
+	}
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/metrics"
+)
+
+// Breaker defaults applied by NewStoreClient
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 10 * time.Second
+	defaultBreakerProbes   = 1
+)
+
+type breakerState int
+
+// Breaker states, in the order of their gauge values
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerHalfOpen:
+		return "half-open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerFailure reports whether err shows the store to be unhealthy, as
+// opposed to rejecting the call itself
+func breakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// circuitBreaker fails calls to one store method fast once it has failed
+// failures times in a row. After cooldown it lets probes calls through,
+// and closes again once they all succeed.
+type circuitBreaker struct {
+	method   string
+	failures int
+	cooldown time.Duration
+	probes   int
+
+	mu    sync.Mutex
+	state breakerState
+	// failed counts consecutive failures while closed
+	failed int
+	// probing and probed count calls let through, and successes seen, while
+	// half-open
+	probing  int
+	probed   int
+	openedAt time.Time
+	// epoch counts state changes. Calls only report to the state they were
+	// admitted in, so a slow call from before the breaker opened is not
+	// taken for a probe.
+	epoch uint64
+}
+
+// allow reports whether a call may be made now, and the epoch to record its
+// outcome with. If not, retryAfter is how long until the breaker lets calls
+// through again.
+func (b *circuitBreaker) allow(ctx context.Context) (epoch uint64, ok bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if wait := time.Until(b.openedAt.Add(b.cooldown)); wait > 0 {
+			return 0, false, wait
+		}
+		b.setState(ctx, breakerHalfOpen)
+	}
+	if b.state == breakerHalfOpen {
+		if b.probing >= b.probes {
+			// Probes normally answer quickly; ask callers to come back soon
+			return 0, false, time.Second
+		}
+		b.probing++
+	}
+	return b.epoch, true, 0
+}
+
+// record feeds the outcome of a call allowed in epoch into the breaker.
+// Outcomes of calls allowed before the breaker last changed state are
+// ignored.
+func (b *circuitBreaker) record(ctx context.Context, epoch uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if epoch != b.epoch {
+		return
+	}
+	// A call the caller gave up on, or ran out of time for, says nothing
+	// about the store
+	canceled := status.Code(err) == codes.Canceled || ctx.Err() != nil
+	switch b.state {
+	case breakerClosed:
+		if canceled {
+			return
+		}
+		if !breakerFailure(err) {
+			b.failed = 0
+		} else if b.failed++; b.failed >= b.failures {
+			b.setState(ctx, breakerOpen)
+		}
+	case breakerHalfOpen:
+		b.probing--
+		if canceled {
+			return
+		}
+		if breakerFailure(err) {
+			b.setState(ctx, breakerOpen)
+		} else if b.probed++; b.probed >= b.probes {
+			b.setState(ctx, breakerClosed)
+		}
+	}
+}
+
+// setState moves the breaker to state, recording the transition on the span
+// of the call that caused it
+func (b *circuitBreaker) setState(ctx context.Context, state breakerState) {
+	trace.SpanFromContext(ctx).AddEvent("circuit_breaker.state_change", trace.WithAttributes(
+		attribute.String("rpc.method", b.method),
+		attribute.String("circuit_breaker.from", b.state.String()),
+		attribute.String("circuit_breaker.to", state.String()),
+	))
+	b.state = state
+	b.epoch++
+	b.failed, b.probing, b.probed = 0, 0, 0
+	if state == breakerOpen {
+		b.openedAt = time.Now()
+	}
+	metrics.SetCircuitBreakerState(b.method, int(state))
+}
+
+// breakerSet holds a circuit breaker for each store method
+type breakerSet struct {
+	failures int
+	cooldown time.Duration
+	probes   int
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func (s *breakerSet) get(method string) *circuitBreaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.breakers == nil {
+		s.breakers = make(map[string]*circuitBreaker)
+	}
+	b, ok := s.breakers[method]
+	if !ok {
+		b = &circuitBreaker{method: method, failures: s.failures, cooldown: s.cooldown, probes: s.probes}
+		s.breakers[method] = b
+		metrics.SetCircuitBreakerState(method, int(breakerClosed))
+	}
+	return b
+}
+
+// interceptor fails calls with Unavailable while their method's breaker is
+// open. The error carries a RetryInfo detail, so it is reported with a
+// Retry-After header. Canary requests are routed to other store instances,
+// so they neither trip nor wait on the breakers.
+func (s *breakerSet) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, canary := canaryctx.FromContext(ctx); canary {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		b := s.get(path.Base(method))
+		epoch, ok, retryAfter := b.allow(ctx)
+		if !ok {
+			st, err := status.New(codes.Unavailable, "circuit breaker open for "+b.method).WithDetails(&errdetails.RetryInfo{
+				RetryDelay: durationpb.New(retryAfter),
+			})
+			if err != nil {
+				return status.Error(codes.Unavailable, "circuit breaker open for "+b.method)
+			}
+			return st.Err()
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(ctx, epoch, err)
+		return err
+	}
+}
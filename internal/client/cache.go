@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/rinsecrm/api-service/internal/cache"
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/metrics"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// Cache names used in metrics
+const (
+	itemCacheName = "item"
+	listCacheName = "list"
+)
+
+type bypassCacheKey struct{}
+
+// BypassCache makes reads with the returned context go to the store. Reads
+// that decide a write use it, so the write is never based on a cached copy.
+func BypassCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassCacheKey{}).(bool)
+	return bypass
+}
+
+type itemKey struct {
+	tenantID int64
+	id       string
+}
+
+// listKey identifies a ListItems call. generation ties it to the tenant's
+// state when it was read, so any write by the tenant retires it.
+type listKey struct {
+	tenantID    int64
+	generation  uint64
+	category    pb.ItemCategory
+	status      pb.ItemStatus
+	searchQuery string
+	pageSize    int32
+	pageToken   string
+}
+
+type listResult struct {
+	items         []*pb.Item
+	nextPageToken string
+	totalCount    int32
+}
+
+// readCache holds the results of GetItem and ListItems. Writes made through
+// the StoreClient invalidate it; writes made elsewhere, such as by other
+// replicas, are only seen once entries expire. Tenant generations are kept
+// even when caching is disabled, since coalesced reads rely on them too.
+type readCache struct {
+	// items and lists are nil when caching is disabled
+	items *cache.LRU[itemKey, *pb.Item]
+	lists *cache.LRU[listKey, listResult]
+
+	mu sync.Mutex
+	// generations counts the writes made by each tenant
+	generations map[int64]uint64
+}
+
+func newReadCache(size int, ttl time.Duration) *readCache {
+	c := &readCache{generations: make(map[int64]uint64)}
+	if size > 0 {
+		c.items = cache.New[itemKey, *pb.Item](size, ttl)
+		c.lists = cache.New[listKey, listResult](size, ttl)
+	}
+	return c
+}
+
+func (c *readCache) enabled() bool {
+	return c.items != nil
+}
+
+// generation returns the tenant's current generation. It is taken before a
+// read so that a result the tenant wrote over in the meantime is neither
+// cached nor shared with reads that follow the write.
+func (c *readCache) generation(tenantID int64) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[tenantID]
+}
+
+func (c *readCache) getItem(tenantID int64, id string) (*pb.Item, bool) {
+	item, ok := c.items.Get(itemKey{tenantID: tenantID, id: id})
+	recordCacheLookup(itemCacheName, ok)
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(item).(*pb.Item), true
+}
+
+func (c *readCache) addItem(tenantID int64, generation uint64, item *pb.Item) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[tenantID] == generation {
+		c.items.Add(itemKey{tenantID: tenantID, id: item.Id}, proto.Clone(item).(*pb.Item))
+	}
+}
+
+func (c *readCache) getList(key listKey) (listResult, bool) {
+	result, ok := c.lists.Get(key)
+	recordCacheLookup(listCacheName, ok)
+	if !ok {
+		return listResult{}, false
+	}
+	return listResult{items: cloneItems(result.items), nextPageToken: result.nextPageToken, totalCount: result.totalCount}, true
+}
+
+func (c *readCache) addList(key listKey, result listResult) {
+	result.items = cloneItems(result.items)
+	c.lists.Add(key, result)
+}
+
+// invalidate retires the tenant's cached listings and, if id is set, the
+// cached item
+func (c *readCache) invalidate(tenantID int64, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generations[tenantID]++
+	if id != "" && c.enabled() {
+		c.items.Remove(itemKey{tenantID: tenantID, id: id})
+	}
+}
+
+// readsCache reports whether a read with ctx may be answered from the cache.
+// Canary requests are routed to other store instances, so they neither read
+// nor fill it.
+func (s *StoreClient) readsCache(ctx context.Context) bool {
+	return s.fillsCache(ctx) && !cacheBypassed(ctx)
+}
+
+// fillsCache reports whether the result of a read with ctx may be cached
+func (s *StoreClient) fillsCache(ctx context.Context) bool {
+	_, canary := canaryctx.FromContext(ctx)
+	return s.cache.enabled() && !canary
+}
+
+func cloneItems(items []*pb.Item) []*pb.Item {
+	clones := make([]*pb.Item, len(items))
+	for i, item := range items {
+		clones[i] = proto.Clone(item).(*pb.Item)
+	}
+	return clones
+}
+
+func recordCacheLookup(name string, hit bool) {
+	if hit {
+		metrics.RecordCacheHit(name)
+	} else {
+		metrics.RecordCacheMiss(name)
+	}
+}
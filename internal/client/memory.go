@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// Page sizes applied by MemoryStore.ListItems, matching store-service
+const (
+	memoryDefaultPageSize = 10
+	memoryMaxPageSize     = 100
+)
+
+// MemoryStore is an in-process Store. Like store-service it keeps tenants
+// apart, lists items in ID order with offset page tokens, and refuses to
+// take inventory below zero. Reads and writes are copies, so callers never
+// share items with the store.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]*pb.Item
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]*pb.Item)}
+}
+
+func (m *MemoryStore) CreateItem(ctx context.Context, tenantID int64, name, description string, price float64, category pb.ItemCategory, sku string, inventoryCount int32, tags []string, createdBy string) (*pb.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, status.Errorf(codes.Internal, "generate id: %v", err)
+	}
+
+	now := timestamppb.Now()
+	item := &pb.Item{
+		Id:             hex.EncodeToString(id),
+		TenantId:       tenantID,
+		Name:           name,
+		Description:    description,
+		Price:          price,
+		Category:       category,
+		Status:         pb.ItemStatus_ITEM_STATUS_ACTIVE,
+		Sku:            sku,
+		InventoryCount: inventoryCount,
+		Tags:           append([]string(nil), tags...),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		CreatedBy:      createdBy,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[item.Id] = item
+	return proto.Clone(item).(*pb.Item), nil
+}
+
+func (m *MemoryStore) GetItem(ctx context.Context, tenantID int64, id string) (*pb.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, err := m.findLocked(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(item).(*pb.Item), nil
+}
+
+func (m *MemoryStore) UpdateItem(ctx context.Context, tenantID int64, id, name, description string, price float64, category pb.ItemCategory, itemStatus pb.ItemStatus, sku string, inventoryCount int32, tags []string, updatedBy string) (*pb.Item, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.findLocked(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	item := proto.Clone(existing).(*pb.Item)
+	item.Name = name
+	item.Description = description
+	item.Price = price
+	item.Sku = sku
+	item.InventoryCount = inventoryCount
+	item.Tags = append([]string(nil), tags...)
+	item.UpdatedBy = updatedBy
+	item.UpdatedAt = timestamppb.Now()
+	// Unspecified enums leave the stored value alone
+	if category != pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED {
+		item.Category = category
+	}
+	if itemStatus != pb.ItemStatus_ITEM_STATUS_UNSPECIFIED {
+		item.Status = itemStatus
+	}
+	m.items[id] = item
+	return proto.Clone(item).(*pb.Item), nil
+}
+
+func (m *MemoryStore) DeleteItem(ctx context.Context, tenantID int64, id string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, status.FromContextError(err).Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findLocked(tenantID, id); err != nil {
+		return false, nil
+	}
+	delete(m.items, id)
+	return true, nil
+}
+
+func (m *MemoryStore) ListItems(ctx context.Context, tenantID int64, category pb.ItemCategory, itemStatus pb.ItemStatus, searchQuery string, pageSize int32, pageToken string) ([]*pb.Item, string, int32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", 0, status.FromContextError(err).Err()
+	}
+	offset := 0
+	if pageToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(pageToken); err != nil || offset < 0 {
+			return nil, "", 0, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+	}
+	if pageSize <= 0 {
+		pageSize = memoryDefaultPageSize
+	}
+	pageSize = min(pageSize, memoryMaxPageSize)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	search := strings.ToLower(searchQuery)
+	var matches []*pb.Item
+	for _, item := range m.items {
+		if item.TenantId != tenantID ||
+			category != pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED && item.Category != category ||
+			itemStatus != pb.ItemStatus_ITEM_STATUS_UNSPECIFIED && item.Status != itemStatus ||
+			search != "" && !itemMatchesSearch(item, search) {
+			continue
+		}
+		matches = append(matches, item)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Id < matches[j].Id })
+
+	end := min(offset+int(pageSize), len(matches))
+	var nextPageToken string
+	if end < len(matches) {
+		nextPageToken = strconv.Itoa(end)
+	}
+	var page []*pb.Item
+	if offset < len(matches) {
+		page = cloneItems(matches[offset:end])
+	}
+	return page, nextPageToken, int32(len(matches)), nil
+}
+
+func (m *MemoryStore) UpdateInventory(ctx context.Context, tenantID int64, itemID string, quantityChange int32, reason, updatedBy string) (*pb.Item, int32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, status.FromContextError(err).Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, err := m.findLocked(tenantID, itemID)
+	if err != nil {
+		return nil, 0, err
+	}
+	previousCount := existing.InventoryCount
+	if int64(previousCount)+int64(quantityChange) < 0 {
+		return nil, 0, status.Error(codes.FailedPrecondition, "insufficient inventory")
+	}
+	item := proto.Clone(existing).(*pb.Item)
+	item.InventoryCount += quantityChange
+	item.UpdatedBy = updatedBy
+	item.UpdatedAt = timestamppb.Now()
+	m.items[itemID] = item
+	return proto.Clone(item).(*pb.Item), previousCount, nil
+}
+
+// findLocked returns the tenant's item; items of other tenants are reported
+// as missing
+func (m *MemoryStore) findLocked(tenantID int64, id string) (*pb.Item, error) {
+	item, ok := m.items[id]
+	if !ok || item.TenantId != tenantID {
+		return nil, status.Error(codes.NotFound, "item not found")
+	}
+	return item, nil
+}
+
+// itemMatchesSearch reports whether the lower-cased search text appears in
+// the item's name, description, SKU or tags
+func itemMatchesSearch(item *pb.Item, search string) bool {
+	text := []string{item.Name, item.Description, item.Sku}
+	text = append(text, item.Tags...)
+	for _, value := range text {
+		if strings.Contains(strings.ToLower(value), search) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"math/rand/v2"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/rinsecrm/api-service/internal/metrics"
+)
+
+// Retry defaults applied by NewStoreClient
+const (
+	defaultMaxAttempts     = 3
+	defaultRetryBackoff    = 50 * time.Millisecond
+	defaultMaxRetryBackoff = time.Second
+)
+
+// idempotencyKeyMetadata carries a write's idempotency key to the store, so
+// that it can recognise a retried call
+const idempotencyKeyMetadata = "idempotency-key"
+
+// idempotentMethods are the store RPCs that are always safe to repeat
+var idempotentMethods = map[string]bool{
+	"GetItem":   true,
+	"ListItems": true,
+}
+
+// Attempt kinds used in metrics
+const (
+	attemptFirst = "first"
+	attemptRetry = "retry"
+	attemptHedge = "hedge"
+)
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey attaches the idempotency key of the request being served
+// to ctx. Writes made with it may be retried, and send the key to the store.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+// WithIdempotencyKeySuffix derives a key for one of several writes made under
+// the same idempotency key. It returns ctx unchanged if there is no key.
+func WithIdempotencyKeySuffix(ctx context.Context, suffix string) context.Context {
+	key, ok := idempotencyKeyFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return WithIdempotencyKey(ctx, key+"/"+suffix)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyKey{}).(string)
+	return key, ok && key != ""
+}
+
+type attemptKey struct{}
+
+func attemptFromContext(ctx context.Context) string {
+	if attempt, ok := ctx.Value(attemptKey{}).(string); ok {
+		return attempt
+	}
+	return attemptFirst
+}
+
+// retryPolicy retries reads that failed with Unavailable or timed out, and
+// writes with an idempotency key that failed with Unavailable, backing off
+// exponentially with full jitter. It optionally hedges idempotent reads.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	hedgeDelay  time.Duration
+}
+
+func (p retryPolicy) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		read := idempotentMethods[path.Base(method)]
+		idempotent := read
+		if key, ok := idempotencyKeyFromContext(ctx); ok && !idempotent {
+			ctx = metadata.AppendToOutgoingContext(ctx, idempotencyKeyMetadata, key)
+			idempotent = true
+		}
+		if !idempotent {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		call := invoker
+		if p.hedgeDelay > 0 && read {
+			call = p.hedged(invoker)
+		}
+
+		backoff := p.backoff
+		for attempt := 1; ; attempt++ {
+			attemptCtx := ctx
+			if attempt > 1 {
+				attemptCtx = context.WithValue(ctx, attemptKey{}, attemptRetry)
+			}
+			err := call(attemptCtx, method, req, reply, cc, opts...)
+			if !retryable(ctx, err, read) || attempt >= p.maxAttempts {
+				return err
+			}
+
+			delay := rand.N(backoff + 1)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return err
+			}
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return err
+			}
+			backoff = min(2*backoff, p.maxBackoff)
+		}
+	}
+}
+
+// hedged wraps invoker so that a second call is sent if the first has not
+// answered within the hedge delay. The first successful reply wins and the
+// other call is canceled.
+func (p retryPolicy) hedged(invoker grpc.UnaryInvoker) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			reply proto.Message
+			err   error
+		}
+		results := make(chan result, 2)
+		send := func(ctx context.Context) {
+			attemptReply := reply.(proto.Message).ProtoReflect().New().Interface()
+			err := invoker(ctx, method, req, attemptReply, cc, opts...)
+			results <- result{reply: attemptReply, err: err}
+		}
+		go send(ctx)
+
+		timer := time.NewTimer(p.hedgeDelay)
+		defer timer.Stop()
+		pending := 1
+		var err error
+		for pending > 0 {
+			select {
+			case <-timer.C:
+				go send(context.WithValue(ctx, attemptKey{}, attemptHedge))
+				pending++
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					proto.Merge(reply.(proto.Message), res.reply)
+					return nil
+				}
+				err = res.err
+				if !retryable(ctx, err, true) {
+					return err
+				}
+			}
+		}
+		return err
+	}
+}
+
+// retryable reports whether a call made with ctx that failed with err may be
+// tried again: the store was unavailable, or a read ran out of its own time
+// while the caller still has some. A write that timed out may still be
+// applied, so it is not resent even with an idempotency key.
+func retryable(ctx context.Context, err error, read bool) bool {
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return true
+	case codes.DeadlineExceeded:
+		return read && ctx.Err() == nil
+	}
+	return false
+}
+
+// metricsInterceptor counts every call sent to the store, including retries
+// and hedged calls
+func metricsInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	metrics.RecordGRPCClientCall(service, name, status.Code(err).String(), attemptFromContext(ctx))
+	metrics.RecordGRPCClientCallDuration(service, name, time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+)
+
+// flightGroup lets concurrent identical reads share one store call
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a store call in progress. It runs with the values and deadline
+// of the context that started it, and is canceled once every caller waiting
+// on it has given up.
+type flight struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+	// deadline is the call's deadline, if hasDeadline
+	deadline    time.Time
+	hasDeadline bool
+}
+
+// covers reports whether the flight may run for as long as a caller with ctx
+// allows, so that joining it cannot cut the caller's time short
+func (f *flight) covers(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return !f.hasDeadline || ok && !deadline.After(f.deadline)
+}
+
+// do calls fn, unless a call with the same key is already in flight, in
+// which case it waits for that call's result; joined reports the latter.
+// Every caller gets the same value. A caller with more time than the call in
+// flight starts a new call, which later callers join instead.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (value interface{}, joined bool, err error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, joined := g.flights[key]
+	if joined && !f.covers(ctx) {
+		joined = false
+	}
+	if !joined {
+		// The call outlives any one caller's cancellation, but keeps the
+		// starting caller's deadline so that it reaches the store
+		flightCtx := context.WithoutCancel(ctx)
+		f = &flight{done: make(chan struct{})}
+		f.deadline, f.hasDeadline = ctx.Deadline()
+		if f.hasDeadline {
+			flightCtx, f.cancel = context.WithDeadline(flightCtx, f.deadline)
+		} else {
+			flightCtx, f.cancel = context.WithCancel(flightCtx)
+		}
+		g.flights[key] = f
+		go g.run(flightCtx, key, f, fn)
+	}
+	f.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, joined, f.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Later callers start afresh rather than join a canceled call
+			f.cancel()
+			g.forget(key, f)
+		}
+		g.mu.Unlock()
+		return nil, joined, ctx.Err()
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(ctx context.Context) (interface{}, error)) {
+	defer f.cancel()
+	f.value, f.err = fn(ctx)
+
+	g.mu.Lock()
+	g.forget(key, f)
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// forget removes f from the group unless a newer call has replaced it
+func (g *flightGroup) forget(key string, f *flight) {
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+}
+
+// flightKey identifies a read for coalescing. Canary requests are routed to
+// other store instances, so they only share calls with each other.
+func flightKey(ctx context.Context, method string, args ...interface{}) string {
+	canary, _ := canaryctx.FromContext(ctx)
+	return fmt.Sprintf("%s %q %#v", method, canary, args)
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/rinsecrm/api-service/internal/cache"
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/metrics"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// defaultStaleTTL applies when the stale fallback is enabled without a TTL
+const defaultStaleTTL = time.Hour
+
+// Staleness records whether reads made with a context from AllowStale were
+// answered with stale data, and how old the oldest such answer was
+type Staleness struct {
+	mu        sync.Mutex
+	stale     bool
+	fetchedAt time.Time
+}
+
+type staleKey struct{}
+
+// AllowStale lets GetItem and ListItems calls made with the returned context
+// fall back to the last response the store gave for them when the store is
+// unavailable, too slow, or behind an open circuit breaker. The returned
+// Staleness reports whether any of them did.
+func AllowStale(ctx context.Context) (context.Context, *Staleness) {
+	staleness := &Staleness{}
+	return context.WithValue(ctx, staleKey{}, staleness), staleness
+}
+
+// Stale reports whether a stale response was served, and its age
+func (s *Staleness) Stale() (age time.Duration, stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stale {
+		return 0, false
+	}
+	return time.Since(s.fetchedAt), true
+}
+
+func (s *Staleness) record(fetchedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stale || fetchedAt.Before(s.fetchedAt) {
+		s.stale, s.fetchedAt = true, fetchedAt
+	}
+}
+
+type staleItem struct {
+	item      *pb.Item
+	fetchedAt time.Time
+}
+
+type staleList struct {
+	result    listResult
+	fetchedAt time.Time
+}
+
+// staleCache keeps the last good response for each read, for much longer than
+// the read cache. Writes through this client retire entries as they do in the
+// read cache: the written item is dropped, and listings are keyed by the
+// tenant's generation, so a delete or update is never read back.
+type staleCache struct {
+	// items and lists are nil when the fallback is disabled
+	items *cache.LRU[itemKey, staleItem]
+	lists *cache.LRU[listKey, staleList]
+}
+
+func newStaleCache(size int, ttl time.Duration) *staleCache {
+	if size <= 0 {
+		return &staleCache{}
+	}
+	return &staleCache{
+		items: cache.New[itemKey, staleItem](size, ttl),
+		lists: cache.New[listKey, staleList](size, ttl),
+	}
+}
+
+func (c *staleCache) enabled() bool {
+	return c.items != nil
+}
+
+func (c *staleCache) addItem(tenantID int64, item *pb.Item) {
+	c.items.Add(itemKey{tenantID: tenantID, id: item.Id}, staleItem{item: proto.Clone(item).(*pb.Item), fetchedAt: time.Now()})
+}
+
+func (c *staleCache) addList(key listKey, result listResult) {
+	result.items = cloneItems(result.items)
+	c.lists.Add(key, staleList{result: result, fetchedAt: time.Now()})
+}
+
+func (c *staleCache) removeItem(tenantID int64, id string) {
+	c.items.Remove(itemKey{tenantID: tenantID, id: id})
+}
+
+// keepsStale reports whether the result of a read with ctx is kept for the
+// fallback. Canary requests are routed to other store instances, so they
+// neither fill nor fall back to it.
+func (s *StoreClient) keepsStale(ctx context.Context) bool {
+	_, canary := canaryctx.FromContext(ctx)
+	return s.stale.enabled() && !canary
+}
+
+// staleFallback reports whether a read with ctx that failed with err may be
+// answered from the stale cache
+func (s *StoreClient) staleFallback(ctx context.Context, err error) (*Staleness, bool) {
+	staleness, ok := ctx.Value(staleKey{}).(*Staleness)
+	if !ok || !s.keepsStale(ctx) {
+		return nil, false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return staleness, true
+	}
+	// The caller's own deadline surfaces as a context error
+	return staleness, ctx.Err() == context.DeadlineExceeded
+}
+
+// staleItem answers a failed GetItem from the stale cache, if it can
+func (s *StoreClient) staleItem(ctx context.Context, tenantID int64, id string, err error) (*pb.Item, bool) {
+	staleness, ok := s.staleFallback(ctx, err)
+	if !ok {
+		return nil, false
+	}
+	entry, ok := s.stale.items.Get(itemKey{tenantID: tenantID, id: id})
+	if !ok {
+		return nil, false
+	}
+	staleness.record(entry.fetchedAt)
+	metrics.RecordStaleServe("GetItem")
+	return proto.Clone(entry.item).(*pb.Item), true
+}
+
+// staleList answers a failed ListItems from the stale cache, if it can
+func (s *StoreClient) staleList(ctx context.Context, key listKey, err error) (listResult, bool) {
+	staleness, ok := s.staleFallback(ctx, err)
+	if !ok {
+		return listResult{}, false
+	}
+	entry, ok := s.stale.lists.Get(key)
+	if !ok {
+		return listResult{}, false
+	}
+	staleness.record(entry.fetchedAt)
+	metrics.RecordStaleServe("ListItems")
+	result := entry.result
+	result.items = cloneItems(result.items)
+	return result, true
+}
@@ -3,24 +3,139 @@ package client
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/metrics"
 	pb "github.com/rinsecrm/api-service/proto/go"
 )
 
+// defaultCacheTTL applies when caching is enabled without a TTL
+const defaultCacheTTL = 30 * time.Second
+
+type Config struct {
+	// CacheSize bounds the items, and separately the list pages, kept in the
+	// read cache; 0 disables caching
+	CacheSize int
+	// CacheTTL is how long a cached read is served
+	CacheTTL time.Duration
+	// MaxAttempts bounds the calls made for one GetItem or ListItems, or a
+	// write with an idempotency key, when the store is Unavailable. Reads
+	// are also retried when a call times out, writes are not. 1 disables
+	// retries
+	MaxAttempts int
+	// RetryBackoff bounds the jittered delay before the first retry; it
+	// doubles for each later retry up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// HedgeDelay, if set, sends a second GetItem or ListItems call when the
+	// first has not answered within it
+	HedgeDelay time.Duration
+	// BreakerFailures consecutive failed calls to a store method open its
+	// circuit breaker
+	BreakerFailures int
+	// BreakerCooldown is how long an open breaker fails calls before it lets
+	// BreakerProbes calls through; the breaker closes once they all succeed
+	BreakerCooldown time.Duration
+	BreakerProbes   int
+	// CallTimeout bounds each call to a store method not in MethodTimeouts,
+	// including each retry
+	CallTimeout    time.Duration
+	MethodTimeouts map[string]time.Duration
+	// StaleCacheSize bounds the items, and separately the list pages, kept
+	// as a fallback for when the store cannot answer; 0 disables it
+	StaleCacheSize int
+	// StaleTTL is how long a response is kept for the fallback
+	StaleTTL time.Duration
+	// DialOptions are added to those the store connection is made with, e.g.
+	// to dial an in-process store in tests
+	DialOptions []grpc.DialOption
+}
+
+// Store is the item storage the API is built on. StoreClient implements it
+// with store-service; MemoryStore is an in-process implementation for tests
+// and local runs.
+type Store interface {
+	CreateItem(ctx context.Context, tenantID int64, name, description string, price float64, category pb.ItemCategory, sku string, inventoryCount int32, tags []string, createdBy string) (*pb.Item, error)
+	GetItem(ctx context.Context, tenantID int64, id string) (*pb.Item, error)
+	UpdateItem(ctx context.Context, tenantID int64, id, name, description string, price float64, category pb.ItemCategory, status pb.ItemStatus, sku string, inventoryCount int32, tags []string, updatedBy string) (*pb.Item, error)
+	// DeleteItem reports false if there was no such item
+	DeleteItem(ctx context.Context, tenantID int64, id string) (bool, error)
+	// ListItems returns a page of the tenant's items in ID order, the token
+	// of the next page if there is one, and the number of matching items
+	ListItems(ctx context.Context, tenantID int64, category pb.ItemCategory, status pb.ItemStatus, searchQuery string, pageSize int32, pageToken string) ([]*pb.Item, string, int32, error)
+	// UpdateInventory adjusts an item's inventory count by quantityChange and
+	// returns the item with the count before the change
+	UpdateInventory(ctx context.Context, tenantID int64, itemID string, quantityChange int32, reason, updatedBy string) (*pb.Item, int32, error)
+}
+
 type StoreClient struct {
-	client pb.StoreServiceClient
-	conn   *grpc.ClientConn
+	client  pb.StoreServiceClient
+	conn    *grpc.ClientConn
+	cache   *readCache
+	stale   *staleCache
+	flights flightGroup
 }
 
-func NewStoreClient(address string) (*StoreClient, error) {
-	conn, err := grpc.NewClient(address,
+func NewStoreClient(address string, config Config) (*StoreClient, error) {
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = defaultCacheTTL
+	}
+	if config.StaleTTL <= 0 {
+		config.StaleTTL = defaultStaleTTL
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.MaxRetryBackoff < config.RetryBackoff {
+		config.MaxRetryBackoff = max(defaultMaxRetryBackoff, config.RetryBackoff)
+	}
+	if config.BreakerFailures <= 0 {
+		config.BreakerFailures = defaultBreakerFailures
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = defaultBreakerCooldown
+	}
+	if config.BreakerProbes <= 0 {
+		config.BreakerProbes = defaultBreakerProbes
+	}
+	breakers := &breakerSet{
+		failures: config.BreakerFailures,
+		cooldown: config.BreakerCooldown,
+		probes:   config.BreakerProbes,
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = defaultCallTimeout
+	}
+	timeouts := callTimeouts{
+		fallback: config.CallTimeout,
+		methods:  config.MethodTimeouts,
+	}
+	retries := retryPolicy{
+		maxAttempts: config.MaxAttempts,
+		backoff:     config.RetryBackoff,
+		maxBackoff:  config.MaxRetryBackoff,
+		hedgeDelay:  config.HedgeDelay,
+	}
+
+	dialOptions := append([]grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithUnaryInterceptor(canaryctx.UnaryClientInterceptor()),
-	)
+		grpc.WithChainUnaryInterceptor(
+			canaryctx.UnaryClientInterceptor(),
+			breakers.interceptor(),
+			retries.interceptor(),
+			timeouts.interceptor(),
+			metricsInterceptor,
+		),
+	}, config.DialOptions...)
+	conn, err := grpc.NewClient(address, dialOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to store service: %w", err)
 	}
@@ -30,14 +145,26 @@ func NewStoreClient(address string) (*StoreClient, error) {
 	return &StoreClient{
 		client: client,
 		conn:   conn,
+		cache:  newReadCache(config.CacheSize, config.CacheTTL),
+		stale:  newStaleCache(config.StaleCacheSize, config.StaleTTL),
 	}, nil
 }
 
+// invalidate drops cached reads a write may have changed. It runs whether or
+// not the write succeeded, since a failed call may still have been applied.
+func (s *StoreClient) invalidate(tenantID int64, id string) {
+	s.cache.invalidate(tenantID, id)
+	if id != "" && s.stale.enabled() {
+		s.stale.removeItem(tenantID, id)
+	}
+}
+
 func (s *StoreClient) Close() error {
 	return s.conn.Close()
 }
 
 func (s *StoreClient) CreateItem(ctx context.Context, tenantID int64, name, description string, price float64, category pb.ItemCategory, sku string, inventoryCount int32, tags []string, createdBy string) (*pb.Item, error) {
+	defer s.invalidate(tenantID, "")
 	resp, err := s.client.CreateItem(ctx, &pb.CreateItemRequest{
 		TenantId:       tenantID,
 		Name:           name,
@@ -56,6 +183,35 @@ func (s *StoreClient) CreateItem(ctx context.Context, tenantID int64, name, desc
 }
 
 func (s *StoreClient) GetItem(ctx context.Context, tenantID int64, id string) (*pb.Item, error) {
+	if s.readsCache(ctx) {
+		if item, ok := s.cache.getItem(tenantID, id); ok {
+			return item, nil
+		}
+	}
+	generation := s.cache.generation(tenantID)
+	if cacheBypassed(ctx) {
+		return s.getItem(ctx, tenantID, id, generation)
+	}
+
+	value, joined, err := s.flights.do(ctx, flightKey(ctx, "GetItem", tenantID, generation, id), func(ctx context.Context) (interface{}, error) {
+		return s.getItem(ctx, tenantID, id, generation)
+	})
+	if joined {
+		metrics.RecordCoalescedRequest("GetItem")
+	}
+	if err != nil {
+		if item, ok := s.staleItem(ctx, tenantID, id, err); ok {
+			return item, nil
+		}
+		return nil, err
+	}
+	// Every caller gets its own copy, as the result may be shared
+	return proto.Clone(value.(*pb.Item)).(*pb.Item), nil
+}
+
+// getItem reads an item from the store and caches it, unless the tenant
+// has written since generation
+func (s *StoreClient) getItem(ctx context.Context, tenantID int64, id string, generation uint64) (*pb.Item, error) {
 	resp, err := s.client.GetItem(ctx, &pb.GetItemRequest{
 		TenantId: tenantID,
 		Id:       id,
@@ -63,10 +219,18 @@ func (s *StoreClient) GetItem(ctx context.Context, tenantID int64, id string) (*
 	if err != nil {
 		return nil, err
 	}
+	if s.fillsCache(ctx) {
+		s.cache.addItem(tenantID, generation, resp.Item)
+	}
+	// An item read before a write is not kept, so the write is not undone
+	if s.keepsStale(ctx) && s.cache.generation(tenantID) == generation {
+		s.stale.addItem(tenantID, resp.Item)
+	}
 	return resp.Item, nil
 }
 
 func (s *StoreClient) UpdateItem(ctx context.Context, tenantID int64, id, name, description string, price float64, category pb.ItemCategory, status pb.ItemStatus, sku string, inventoryCount int32, tags []string, updatedBy string) (*pb.Item, error) {
+	defer s.invalidate(tenantID, id)
 	resp, err := s.client.UpdateItem(ctx, &pb.UpdateItemRequest{
 		TenantId:       tenantID,
 		Id:             id,
@@ -87,6 +251,7 @@ func (s *StoreClient) UpdateItem(ctx context.Context, tenantID int64, id, name,
 }
 
 func (s *StoreClient) DeleteItem(ctx context.Context, tenantID int64, id string) (bool, error) {
+	defer s.invalidate(tenantID, id)
 	resp, err := s.client.DeleteItem(ctx, &pb.DeleteItemRequest{
 		TenantId: tenantID,
 		Id:       id,
@@ -98,21 +263,66 @@ func (s *StoreClient) DeleteItem(ctx context.Context, tenantID int64, id string)
 }
 
 func (s *StoreClient) ListItems(ctx context.Context, tenantID int64, category pb.ItemCategory, status pb.ItemStatus, searchQuery string, pageSize int32, pageToken string) ([]*pb.Item, string, int32, error) {
-	resp, err := s.client.ListItems(ctx, &pb.ListItemsRequest{
-		TenantId:    tenantID,
-		Category:    category,
-		Status:      status,
-		SearchQuery: searchQuery,
-		PageSize:    pageSize,
-		PageToken:   pageToken,
+	key := listKey{
+		tenantID:    tenantID,
+		generation:  s.cache.generation(tenantID),
+		category:    category,
+		status:      status,
+		searchQuery: searchQuery,
+		pageSize:    pageSize,
+		pageToken:   pageToken,
+	}
+	if s.readsCache(ctx) {
+		if result, ok := s.cache.getList(key); ok {
+			return result.items, result.nextPageToken, result.totalCount, nil
+		}
+	}
+	if cacheBypassed(ctx) {
+		result, err := s.listItems(ctx, key)
+		return result.items, result.nextPageToken, result.totalCount, err
+	}
+
+	value, joined, err := s.flights.do(ctx, flightKey(ctx, "ListItems", key.tenantID, key.generation, key.category, key.status, key.searchQuery, key.pageSize, key.pageToken), func(ctx context.Context) (interface{}, error) {
+		return s.listItems(ctx, key)
 	})
+	if joined {
+		metrics.RecordCoalescedRequest("ListItems")
+	}
 	if err != nil {
+		if result, ok := s.staleList(ctx, key, err); ok {
+			return result.items, result.nextPageToken, result.totalCount, nil
+		}
 		return nil, "", 0, err
 	}
-	return resp.Items, resp.NextPageToken, resp.TotalCount, nil
+	result := value.(listResult)
+	return cloneItems(result.items), result.nextPageToken, result.totalCount, nil
+}
+
+// listItems reads a page of items from the store and caches it
+func (s *StoreClient) listItems(ctx context.Context, key listKey) (listResult, error) {
+	resp, err := s.client.ListItems(ctx, &pb.ListItemsRequest{
+		TenantId:    key.tenantID,
+		Category:    key.category,
+		Status:      key.status,
+		SearchQuery: key.searchQuery,
+		PageSize:    key.pageSize,
+		PageToken:   key.pageToken,
+	})
+	if err != nil {
+		return listResult{}, err
+	}
+	result := listResult{items: resp.Items, nextPageToken: resp.NextPageToken, totalCount: resp.TotalCount}
+	if s.fillsCache(ctx) {
+		s.cache.addList(key, result)
+	}
+	if s.keepsStale(ctx) {
+		s.stale.addList(key, result)
+	}
+	return result, nil
 }
 
 func (s *StoreClient) UpdateInventory(ctx context.Context, tenantID int64, itemID string, quantityChange int32, reason, updatedBy string) (*pb.Item, int32, error) {
+	defer s.invalidate(tenantID, itemID)
 	resp, err := s.client.UpdateInventory(ctx, &pb.UpdateInventoryRequest{
 		TenantId:       tenantID,
 		ItemId:         itemID,
@@ -0,0 +1,338 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/storetest"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+const tenantID = int64(1)
+
+// newStoreClient connects a StoreClient to a fresh fake store. Backoff is
+// kept short so retries do not slow the tests down.
+func newStoreClient(t *testing.T, config client.Config) (*client.StoreClient, *storetest.Server) {
+	t.Helper()
+	server := storetest.NewServer()
+	t.Cleanup(server.Close)
+
+	if config.RetryBackoff == 0 {
+		config.RetryBackoff = time.Millisecond
+	}
+	store, err := server.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func createItem(t *testing.T, store client.Store) *pb.Item {
+	t.Helper()
+	item, err := store.CreateItem(context.Background(), tenantID, "Lamp", "", 10, pb.ItemCategory_ITEM_CATEGORY_HOME, "LAMP-1", 5, nil, "user-1")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	return item
+}
+
+func expectCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %v, want %v (%v)", got, want, err)
+	}
+}
+
+func TestStoreClientRoundTrip(t *testing.T) {
+	store, _ := newStoreClient(t, client.Config{})
+	ctx := context.Background()
+	item := createItem(t, store)
+
+	got, err := store.GetItem(ctx, tenantID, item.Id)
+	if err != nil || got.Name != "Lamp" {
+		t.Fatalf("GetItem = %v, %v", got, err)
+	}
+	_, err = store.GetItem(ctx, tenantID+1, item.Id)
+	expectCode(t, err, codes.NotFound)
+
+	_, previousCount, err := store.UpdateInventory(ctx, tenantID, item.Id, -2, "sold", "user-1")
+	if err != nil || previousCount != 5 {
+		t.Fatalf("UpdateInventory previous count = %d, %v", previousCount, err)
+	}
+	_, _, err = store.UpdateInventory(ctx, tenantID, item.Id, -10, "sold", "user-1")
+	expectCode(t, err, codes.FailedPrecondition)
+
+	items, _, total, err := store.ListItems(ctx, tenantID, pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED, pb.ItemStatus_ITEM_STATUS_UNSPECIFIED, "lamp", 10, "")
+	if err != nil || len(items) != 1 || total != 1 {
+		t.Fatalf("ListItems = %d items, total %d, %v", len(items), total, err)
+	}
+
+	if deleted, err := store.DeleteItem(ctx, tenantID, item.Id); !deleted || err != nil {
+		t.Fatalf("DeleteItem = %v, %v", deleted, err)
+	}
+	if deleted, err := store.DeleteItem(ctx, tenantID, item.Id); deleted || err != nil {
+		t.Fatalf("second DeleteItem = %v, %v", deleted, err)
+	}
+}
+
+func TestStoreClientCanaryMetadata(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{})
+	item := createItem(t, server.Store)
+
+	ctx := canaryctx.WithCanary(context.Background(), "42")
+	if _, err := store.GetItem(ctx, tenantID, item.Id); err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	if _, err := store.GetItem(context.Background(), tenantID, item.Id); err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+
+	calls := server.Calls("GetItem")
+	if len(calls) != 2 {
+		t.Fatalf("got %d calls, want 2", len(calls))
+	}
+	if got := calls[0].Metadata.Get(canaryctx.CanaryHeaderGRPC); len(got) != 1 || got[0] != "42" {
+		t.Fatalf("canary call metadata %s = %v, want [42]", canaryctx.CanaryHeaderGRPC, got)
+	}
+	if got := calls[1].Metadata.Get(canaryctx.CanaryHeaderGRPC); len(got) != 0 {
+		t.Fatalf("plain call metadata %s = %v, want none", canaryctx.CanaryHeaderGRPC, got)
+	}
+}
+
+func TestStoreClientRetriesReads(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{MaxAttempts: 3})
+	item := createItem(t, server.Store)
+
+	server.Inject("GetItem", storetest.Fault{Code: codes.Unavailable, Times: 2})
+	if _, err := store.GetItem(context.Background(), tenantID, item.Id); err != nil {
+		t.Fatalf("GetItem: %v", err)
+	}
+	if calls := len(server.Calls("GetItem")); calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+
+	// Errors about the request itself are not retried
+	server.Inject("GetItem", storetest.Fault{Code: codes.InvalidArgument})
+	_, err := store.GetItem(context.Background(), tenantID, "other")
+	expectCode(t, err, codes.InvalidArgument)
+	if calls := len(server.Calls("GetItem")); calls != 4 {
+		t.Fatalf("got %d calls, want 4", calls)
+	}
+}
+
+func TestStoreClientRetriesWritesWithIdempotencyKey(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{MaxAttempts: 3})
+	item := createItem(t, server.Store)
+	ctx := canaryctx.WithCanary(context.Background(), "7")
+
+	server.Inject("UpdateInventory", storetest.Fault{Code: codes.Unavailable, Times: 1})
+	_, _, err := store.UpdateInventory(ctx, tenantID, item.Id, 1, "", "user-1")
+	expectCode(t, err, codes.Unavailable)
+	if calls := len(server.Calls("UpdateInventory")); calls != 1 {
+		t.Fatalf("write without a key made %d calls, want 1", calls)
+	}
+
+	server.Inject("UpdateInventory", storetest.Fault{Code: codes.Unavailable, Times: 1})
+	keyed := client.WithIdempotencyKey(ctx, "restock-1")
+	if _, _, err := store.UpdateInventory(keyed, tenantID, item.Id, 1, "", "user-1"); err != nil {
+		t.Fatalf("UpdateInventory: %v", err)
+	}
+	calls := server.Calls("UpdateInventory")
+	if len(calls) != 3 {
+		t.Fatalf("write with a key made %d calls in all, want 3", len(calls))
+	}
+	for _, call := range calls[1:] {
+		if got := call.Metadata.Get("idempotency-key"); len(got) != 1 || got[0] != "restock-1" {
+			t.Fatalf("idempotency-key metadata = %v, want [restock-1]", got)
+		}
+		// The key is added alongside the canary metadata, not in place of it
+		if got := call.Metadata.Get(canaryctx.CanaryHeaderGRPC); len(got) != 1 || got[0] != "7" {
+			t.Fatalf("canary metadata = %v, want [7]", got)
+		}
+	}
+}
+
+func TestStoreClientDoesNotResendTimedOutWrites(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{
+		MaxAttempts:    3,
+		MethodTimeouts: map[string]time.Duration{"UpdateInventory": 20 * time.Millisecond},
+	})
+	item := createItem(t, server.Store)
+
+	// The timed out call may still be applied, so even a keyed write is
+	// sent only once
+	server.Inject("UpdateInventory", storetest.Fault{Delay: time.Second, Times: 1})
+	keyed := client.WithIdempotencyKey(context.Background(), "restock-1")
+	_, _, err := store.UpdateInventory(keyed, tenantID, item.Id, 1, "", "user-1")
+	expectCode(t, err, codes.DeadlineExceeded)
+	if calls := len(server.Calls("UpdateInventory")); calls != 1 {
+		t.Fatalf("timed out write made %d calls, want 1", calls)
+	}
+}
+
+func TestStoreClientStaleFallback(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{MaxAttempts: 1, StaleCacheSize: 10})
+	lamp := createItem(t, server.Store)
+	desk, err := server.Store.CreateItem(context.Background(), tenantID, "Desk", "", 100, pb.ItemCategory_ITEM_CATEGORY_HOME, "DESK-1", 1, nil, "user-1")
+	if err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	list := func(ctx context.Context) ([]*pb.Item, error) {
+		items, _, _, err := store.ListItems(ctx, tenantID, pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED, pb.ItemStatus_ITEM_STATUS_UNSPECIFIED, "", 10, "")
+		return items, err
+	}
+
+	// Fill the fallback
+	ctx, _ := client.AllowStale(context.Background())
+	for _, id := range []string{lamp.Id, desk.Id} {
+		if _, err := store.GetItem(ctx, tenantID, id); err != nil {
+			t.Fatalf("GetItem: %v", err)
+		}
+	}
+	if _, err := list(ctx); err != nil {
+		t.Fatalf("ListItems: %v", err)
+	}
+
+	server.Inject("GetItem", storetest.Fault{Code: codes.Unavailable})
+	server.Inject("ListItems", storetest.Fault{Code: codes.Unavailable})
+	ctx, staleness := client.AllowStale(context.Background())
+	if _, err := store.GetItem(ctx, tenantID, lamp.Id); err != nil {
+		t.Fatalf("stale GetItem: %v", err)
+	}
+	if items, err := list(ctx); err != nil || len(items) != 2 {
+		t.Fatalf("stale ListItems = %d items, %v", len(items), err)
+	}
+	if _, stale := staleness.Stale(); !stale {
+		t.Fatal("staleness not reported")
+	}
+	// Without AllowStale the error is returned
+	_, err = store.GetItem(context.Background(), tenantID, lamp.Id)
+	expectCode(t, err, codes.Unavailable)
+
+	// A write retires the written item and the tenant's listings, so the
+	// fallback never brings back a deleted item
+	server.ClearFaults()
+	if _, err := store.DeleteItem(context.Background(), tenantID, lamp.Id); err != nil {
+		t.Fatalf("DeleteItem: %v", err)
+	}
+	server.Inject("GetItem", storetest.Fault{Code: codes.Unavailable})
+	server.Inject("ListItems", storetest.Fault{Code: codes.Unavailable})
+	ctx, _ = client.AllowStale(context.Background())
+	_, err = store.GetItem(ctx, tenantID, lamp.Id)
+	expectCode(t, err, codes.Unavailable)
+	_, err = list(ctx)
+	expectCode(t, err, codes.Unavailable)
+	if _, err := store.GetItem(ctx, tenantID, desk.Id); err != nil {
+		t.Fatalf("stale GetItem of another item: %v", err)
+	}
+}
+
+func TestStoreClientMethodTimeouts(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{
+		MaxAttempts:    2,
+		MethodTimeouts: map[string]time.Duration{"ListItems": 20 * time.Millisecond},
+	})
+
+	server.Inject("ListItems", storetest.Fault{Delay: time.Second})
+	start := time.Now()
+	_, _, _, err := store.ListItems(context.Background(), tenantID, pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED, pb.ItemStatus_ITEM_STATUS_UNSPECIFIED, "", 10, "")
+	expectCode(t, err, codes.DeadlineExceeded)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("ListItems took %v", elapsed)
+	}
+	// Each attempt gets its own timeout
+	if calls := len(server.Calls("ListItems")); calls != 2 {
+		t.Fatalf("got %d calls, want 2", calls)
+	}
+}
+
+func TestStoreClientCircuitBreaker(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{
+		MaxAttempts:     1,
+		BreakerFailures: 2,
+		BreakerCooldown: time.Hour,
+	})
+	item := createItem(t, server.Store)
+
+	server.Inject("GetItem", storetest.Fault{Code: codes.Internal})
+	for i := 0; i < 2; i++ {
+		_, err := store.GetItem(context.Background(), tenantID, item.Id)
+		expectCode(t, err, codes.Internal)
+	}
+	server.ClearFaults()
+
+	_, err := store.GetItem(context.Background(), tenantID, item.Id)
+	expectCode(t, err, codes.Unavailable)
+	if calls := len(server.Calls("GetItem")); calls != 2 {
+		t.Fatalf("got %d calls, want 2 before the breaker opened", calls)
+	}
+
+	// Breakers are kept per method
+	if _, _, _, err := store.ListItems(context.Background(), tenantID, pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED, pb.ItemStatus_ITEM_STATUS_UNSPECIFIED, "", 10, ""); err != nil {
+		t.Fatalf("ListItems: %v", err)
+	}
+}
+
+func TestStoreClientCircuitBreakerIgnoresCallsFromBeforeOpening(t *testing.T) {
+	store, server := newStoreClient(t, client.Config{
+		MaxAttempts:     1,
+		BreakerFailures: 2,
+		BreakerCooldown: 50 * time.Millisecond,
+		BreakerProbes:   1,
+	})
+	get := func(id string) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := store.GetItem(context.Background(), tenantID, id)
+			done <- err
+		}()
+		return done
+	}
+	waitForCalls := func(n int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); len(server.Calls("GetItem")) < n; {
+			if time.Now().After(deadline) {
+				t.Fatalf("store did not get %d calls", n)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// A slow call is admitted while the breaker is closed
+	server.Inject("GetItem", storetest.Fault{Delay: 300 * time.Millisecond, Times: 1})
+	late := get("slow")
+	waitForCalls(1)
+
+	server.Inject("GetItem", storetest.Fault{Code: codes.Internal, Times: 2})
+	for _, id := range []string{"a", "b"} {
+		_, err := store.GetItem(context.Background(), tenantID, id)
+		expectCode(t, err, codes.Internal)
+	}
+
+	// After the cooldown a slow probe is let through
+	time.Sleep(100 * time.Millisecond)
+	server.Inject("GetItem", storetest.Fault{Delay: 400 * time.Millisecond, Times: 1})
+	probe := get("probe")
+	waitForCalls(4)
+
+	// The pre-open call finishing does not close the breaker or free the
+	// probe's slot
+	expectCode(t, <-late, codes.NotFound)
+	_, err := store.GetItem(context.Background(), tenantID, "c")
+	expectCode(t, err, codes.Unavailable)
+	if calls := len(server.Calls("GetItem")); calls != 4 {
+		t.Fatalf("got %d calls, want 4 while the probe runs", calls)
+	}
+
+	// The probe itself closes it
+	expectCode(t, <-probe, codes.NotFound)
+	_, err = store.GetItem(context.Background(), tenantID, "c")
+	expectCode(t, err, codes.NotFound)
+}
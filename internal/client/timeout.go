@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// defaultCallTimeout applies to store methods without a timeout of their own
+const defaultCallTimeout = 10 * time.Second
+
+// callTimeouts bounds each call sent to the store. The deadline of the
+// caller's context still applies when it is sooner, and gRPC passes the
+// earlier of the two on to the store.
+type callTimeouts struct {
+	fallback time.Duration
+	methods  map[string]time.Duration
+}
+
+func (t callTimeouts) interceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		timeout, ok := t.methods[path.Base(method)]
+		if !ok {
+			timeout = t.fallback
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ParseMethodTimeouts parses per-method call timeouts written as
+// "method=duration", separated by commas, e.g. "GetItem=2s,ListItems=5s"
+func ParseMethodTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		method, value, ok := strings.Cut(entry, "=")
+		if !ok || method == "" {
+			return nil, fmt.Errorf("invalid method timeout %q: want method=duration", entry)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid duration in method timeout %q", entry)
+		}
+		timeouts[strings.TrimSpace(method)] = timeout
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,70 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type state struct {
+	Offset int    `json:"offset"`
+	LastID string `json:"last_id"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	codec := NewCodec([]byte("key"))
+	token, err := codec.Encode(1, "category=books", state{Offset: 20, LastID: "abc"})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var got state
+	if err := codec.Decode(token, 1, "category=books", &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got != (state{Offset: 20, LastID: "abc"}) {
+		t.Fatalf("decoded %+v", got)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	codec := NewCodec([]byte("key"))
+	token, err := codec.Encode(1, "category=books", state{Offset: 20})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	payload, signature, _ := strings.Cut(token, ".")
+
+	// tampered changes the payload but keeps the original signature
+	tampered := func() string {
+		data, _ := base64.RawURLEncoding.DecodeString(payload)
+		data = []byte(strings.Replace(string(data), `"offset":20`, `"offset":0`, 1))
+		return base64.RawURLEncoding.EncodeToString(data) + "." + signature
+	}
+	otherKey, _ := NewCodec([]byte("other")).Encode(1, "category=books", state{Offset: 20})
+
+	tests := []struct {
+		name     string
+		token    string
+		tenantID int64
+		scope    string
+	}{
+		{"tampered payload", tampered(), 1, "category=books"},
+		{"truncated signature", token[:len(token)-2], 1, "category=books"},
+		{"signed with another key", otherKey, 1, "category=books"},
+		{"another tenant", token, 2, "category=books"},
+		{"another query", token, 1, "category=toys"},
+		{"no signature", payload, 1, "category=books"},
+		{"not base64", "!!!.???", 1, "category=books"},
+		{"empty", "", 1, "category=books"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got state
+			if err := codec.Decode(tt.token, tt.tenantID, tt.scope, &got); !errors.Is(err, ErrInvalid) {
+				t.Fatalf("err = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
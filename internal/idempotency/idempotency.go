@@ -0,0 +1,46 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrInProgress is returned by Begin while another request holds the key
+var ErrInProgress = errors.New("a request with this idempotency key is in progress")
+
+// ReservationTimeout bounds how long a key stays reserved if the request
+// holding it stops without completing or releasing it. Requests that run
+// longer must Extend their reservation before it lapses.
+const ReservationTimeout = time.Minute
+
+// Record is the first response produced for an idempotency key, replayed
+// when the request is retried
+type Record struct {
+	// Fingerprint identifies the request payload the key was first used with
+	Fingerprint string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// Store persists idempotency records. The in-memory implementation suits a
+// single replica; a shared backend (e.g. Redis with SET NX and EX) is needed
+// once the service runs with more than one.
+type Store interface {
+	// Begin reserves key for a new request for ReservationTimeout. If a
+	// response was already stored for key it is returned and no reservation
+	// is made. If another request holds the reservation, ErrInProgress is
+	// returned.
+	Begin(ctx context.Context, key, fingerprint string) (*Record, error)
+	// Extend renews the reservation of key for another ReservationTimeout.
+	// It does nothing if key is not reserved.
+	Extend(ctx context.Context, key string) error
+	// Complete stores the response for a reserved key for ttl
+	Complete(ctx context.Context, key string, record Record, ttl time.Duration) error
+	// Release drops a reservation without storing a response so the request
+	// can be retried
+	Release(ctx context.Context, key string) error
+}
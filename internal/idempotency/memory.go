@@ -0,0 +1,89 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often expired entries are purged
+const sweepInterval = time.Minute
+
+type entry struct {
+	record    *Record
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]entry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryStore) Begin(ctx context.Context, key, fingerprint string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweepLocked(now)
+
+	if existing, ok := m.entries[key]; ok && now.Before(existing.expiresAt) {
+		if existing.record == nil {
+			return nil, ErrInProgress
+		}
+		return existing.record, nil
+	}
+
+	m.entries[key] = entry{expiresAt: now.Add(ReservationTimeout)}
+	return nil, nil
+}
+
+func (m *MemoryStore) Complete(ctx context.Context, key string, record Record, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = entry{record: &record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Extend(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := m.entries[key]; ok && existing.record == nil && now.Before(existing.expiresAt) {
+		m.entries[key] = entry{expiresAt: now.Add(ReservationTimeout)}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.entries[key]; ok && existing.record == nil {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+func (m *MemoryStore) sweepLocked(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, existing := range m.entries {
+		if !now.Before(existing.expiresAt) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// expire makes key's entry lapse, as if its timeout had passed
+func (m *MemoryStore) expire(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.entries[key]; ok {
+		existing.expiresAt = time.Now().Add(-time.Second)
+		m.entries[key] = existing
+	}
+}
+
+func (m *MemoryStore) expiresAt(key string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[key].expiresAt
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	record := Record{Fingerprint: "fp", StatusCode: 201, Body: []byte("{}")}
+
+	tests := []struct {
+		name        string
+		setup       func(m *MemoryStore)
+		wantRecord  bool
+		wantPending bool
+	}{
+		{"new key", func(m *MemoryStore) {}, false, false},
+		{"reserved key", func(m *MemoryStore) {
+			m.Begin(ctx, "key", "fp")
+		}, false, true},
+		{"completed key", func(m *MemoryStore) {
+			m.Begin(ctx, "key", "fp")
+			m.Complete(ctx, "key", record, time.Hour)
+		}, true, false},
+		{"released key", func(m *MemoryStore) {
+			m.Begin(ctx, "key", "fp")
+			m.Release(ctx, "key")
+		}, false, false},
+		{"release keeps a completed key", func(m *MemoryStore) {
+			m.Complete(ctx, "key", record, time.Hour)
+			m.Release(ctx, "key")
+		}, true, false},
+		{"lapsed reservation", func(m *MemoryStore) {
+			m.Begin(ctx, "key", "fp")
+			m.expire("key")
+		}, false, false},
+		{"expired record", func(m *MemoryStore) {
+			m.Complete(ctx, "key", record, time.Hour)
+			m.expire("key")
+		}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryStore()
+			tt.setup(m)
+
+			got, err := m.Begin(ctx, "key", "fp")
+			if tt.wantPending {
+				if !errors.Is(err, ErrInProgress) {
+					t.Fatalf("err = %v, want ErrInProgress", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			if (got != nil) != tt.wantRecord {
+				t.Fatalf("Begin record = %v, want record %v", got, tt.wantRecord)
+			}
+			if got != nil && (got.StatusCode != 201 || string(got.Body) != "{}") {
+				t.Fatalf("unexpected record %+v", got)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreExtend(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryStore()
+
+	m.Begin(ctx, "key", "fp")
+	m.mu.Lock()
+	m.entries["key"] = entry{expiresAt: time.Now().Add(time.Second)}
+	m.mu.Unlock()
+	if err := m.Extend(ctx, "key"); err != nil {
+		t.Fatalf("Extend: %v", err)
+	}
+	if remaining := time.Until(m.expiresAt("key")); remaining < ReservationTimeout-time.Second {
+		t.Fatalf("reservation lapses in %v, want about %v", remaining, ReservationTimeout)
+	}
+	if _, err := m.Begin(ctx, "key", "fp"); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("err = %v, want ErrInProgress", err)
+	}
+
+	// Completed and lapsed keys are left alone
+	m.Complete(ctx, "done", Record{StatusCode: 200}, time.Hour)
+	expiresAt := m.expiresAt("done")
+	m.Extend(ctx, "done")
+	if !m.expiresAt("done").Equal(expiresAt) {
+		t.Fatal("Extend changed a completed key")
+	}
+	m.Begin(ctx, "lapsed", "fp")
+	m.expire("lapsed")
+	m.Extend(ctx, "lapsed")
+	if _, err := m.Begin(ctx, "lapsed", "fp"); err != nil {
+		t.Fatalf("lapsed reservation was revived: %v", err)
+	}
+}
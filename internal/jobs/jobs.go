@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when no job has the requested ID
+var ErrNotFound = errors.New("job not found")
+
+// ErrQueueFull is returned by Submit when no more jobs can be queued
+var ErrQueueFull = errors.New("job queue is full")
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Finished reports whether the status is terminal
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// maxJobErrors bounds the errors kept on a job; counts stay exact
+const maxJobErrors = 100
+
+// Error describes one item a job could not process
+type Error struct {
+	// Line is the upload line or item position the error refers to
+	Line    int
+	Message string
+}
+
+// Job is the state of one asynchronous job
+type Job struct {
+	ID        string
+	TenantID  int64
+	Type      string
+	CreatedBy string
+	Status    Status
+	// Message explains why a job failed
+	Message string
+
+	// Total is the number of items the job expects to process, 0 if unknown
+	Total     int
+	Processed int
+	Succeeded int
+	Failed    int
+	Errors    []Error
+
+	// InputPath is a local file holding the job's input, if it has one; it
+	// is removed once the job finishes
+	InputPath string
+	// ResultPath is a local file holding the job's output, if it has one
+	ResultPath        string
+	ResultContentType string
+	ResultFilename    string
+
+	CreatedAt  time.Time
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Store persists job state. The in-memory implementation suits a single
+// replica; jobs run on the replica that accepted them, so a shared backend
+// only makes their state visible to the other replicas.
+type Store interface {
+	// Put creates or replaces a job
+	Put(ctx context.Context, job Job) error
+	// Get returns a job, or ErrNotFound
+	Get(ctx context.Context, id string) (Job, error)
+	Delete(ctx context.Context, id string) error
+	// FinishedBefore lists jobs that finished before t
+	FinishedBefore(ctx context.Context, t time.Time) ([]Job, error)
+}
@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/metrics"
+)
+
+// Defaults for unset Config fields
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 100
+	defaultRetention = 24 * time.Hour
+)
+
+// progressSaveInterval throttles how often a running job's progress is saved
+const progressSaveInterval = time.Second
+
+// sweepInterval controls how often expired jobs are purged
+const sweepInterval = time.Minute
+
+// RunFunc performs a job and reports through progress. It should return
+// promptly once ctx is canceled.
+type RunFunc func(ctx context.Context, progress *Progress) error
+
+type Config struct {
+	// Workers is the number of jobs run at the same time
+	Workers int
+	// QueueSize bounds the jobs waiting for a worker
+	QueueSize int
+	// Retention is how long finished jobs and their results are kept
+	Retention time.Duration
+	// ResultDir holds input and result files; defaults to the system temp
+	// directory
+	ResultDir string
+}
+
+// Manager runs submitted jobs on a fixed pool of workers
+type Manager struct {
+	store  Store
+	config Config
+	queue  chan *task
+
+	mu sync.Mutex
+	// tasks holds the jobs that are queued or running
+	tasks map[string]*task
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+type task struct {
+	job     Job
+	run     RunFunc
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+}
+
+// NewManager starts the worker pool
+func NewManager(store Store, config Config) *Manager {
+	if config.Workers <= 0 {
+		config.Workers = defaultWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultQueueSize
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaultRetention
+	}
+	if config.ResultDir == "" {
+		config.ResultDir = os.TempDir()
+	}
+
+	m := &Manager{
+		store:  store,
+		config: config,
+		queue:  make(chan *task, config.QueueSize),
+		tasks:  make(map[string]*task),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < config.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	m.wg.Add(1)
+	go m.sweeper()
+	return m
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Submit queues job to be run by run. The job keeps the values of ctx, such
+// as the caller's identity and trace, but not its cancellation. If the job
+// cannot be queued, its input file is removed.
+func (m *Manager) Submit(ctx context.Context, job Job, run RunFunc) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		removeFile(job.ID, job.InputPath)
+		return Job{}, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	job.ID = id
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	if err := m.store.Put(ctx, job); err != nil {
+		removeFile(job.ID, job.InputPath)
+		return Job{}, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t := &task{job: job, run: run, ctx: runCtx, cancel: cancel}
+
+	m.mu.Lock()
+	select {
+	case m.queue <- t:
+		m.tasks[id] = t
+		m.mu.Unlock()
+	default:
+		m.mu.Unlock()
+		cancel()
+		removeFile(job.ID, job.InputPath)
+		if err := m.store.Delete(ctx, id); err != nil {
+			log.Printf("Error deleting rejected job %s: %v", id, err)
+		}
+		return Job{}, ErrQueueFull
+	}
+
+	metrics.RecordJobSubmitted(job.Type)
+	return job, nil
+}
+
+// CreateInput creates a file in ResultDir to hold a job's input. Set its
+// name as the job's InputPath so it is removed once the job finishes.
+func (m *Manager) CreateInput() (*os.File, error) {
+	return os.CreateTemp(m.config.ResultDir, "input-*")
+}
+
+// Get returns the current state of a job
+func (m *Manager) Get(ctx context.Context, id string) (Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// Cancel stops a job. A queued job is canceled at once; a running job is
+// signalled and reports canceled once its RunFunc returns.
+func (m *Manager) Cancel(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	t, active := m.tasks[id]
+	if active {
+		t.cancel()
+	}
+	if active && !t.started {
+		delete(m.tasks, id)
+		m.mu.Unlock()
+		return m.dropQueued(ctx, t)
+	}
+	m.mu.Unlock()
+
+	return m.store.Get(ctx, id)
+}
+
+// dropQueued records a job canceled before it started, which must already be
+// removed from tasks
+func (m *Manager) dropQueued(ctx context.Context, t *task) (Job, error) {
+	job := t.job
+	job.Status = StatusCanceled
+	job.FinishedAt = time.Now()
+	removeFile(job.ID, job.InputPath)
+	metrics.RecordJobDropped(job.Type)
+	return job, m.store.Put(ctx, job)
+}
+
+// Stop cancels running jobs and waits for the workers to exit. Jobs still
+// queued are marked canceled, as they will never run.
+func (m *Manager) Stop(ctx context.Context) error {
+	close(m.done)
+	var queued []*task
+	m.mu.Lock()
+	for id, t := range m.tasks {
+		t.cancel()
+		if !t.started {
+			delete(m.tasks, id)
+			queued = append(queued, t)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, t := range queued {
+		if _, err := m.dropQueued(ctx, t); err != nil {
+			log.Printf("Error canceling queued job %s: %v", t.job.ID, err)
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.done:
+			return
+		case t := <-m.queue:
+			m.execute(t)
+		}
+	}
+}
+
+func (m *Manager) execute(t *task) {
+	m.mu.Lock()
+	if t.ctx.Err() != nil {
+		// Canceled while queued; Cancel has already recorded it
+		m.mu.Unlock()
+		return
+	}
+	t.started = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.tasks, t.job.ID)
+		m.mu.Unlock()
+		t.cancel()
+	}()
+
+	metrics.RecordJobStarted(t.job.Type)
+	progress := &Progress{store: m.store, resultDir: m.config.ResultDir, job: t.job}
+	progress.start()
+	progress.finish(runSafely(t.ctx, t.run, progress), t.ctx.Err())
+}
+
+// runSafely turns a panic in a job into its error, so one bad job cannot
+// take the service down
+func runSafely(ctx context.Context, run RunFunc, progress *Progress) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return run(ctx, progress)
+}
+
+func (m *Manager) sweeper() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.sweep(now)
+		}
+	}
+}
+
+// sweep deletes jobs, and their result files, once they are past retention
+func (m *Manager) sweep(now time.Time) {
+	ctx := context.Background()
+	expired, err := m.store.FinishedBefore(ctx, now.Add(-m.config.Retention))
+	if err != nil {
+		log.Printf("Error listing expired jobs: %v", err)
+		return
+	}
+	for _, job := range expired {
+		removeFile(job.ID, job.ResultPath)
+		if err := m.store.Delete(ctx, job.ID); err != nil {
+			log.Printf("Error deleting expired job %s: %v", job.ID, err)
+		}
+	}
+}
+
+// removeFile deletes a job's input or result file, if it has one
+func removeFile(jobID, path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing file of job %s: %v", jobID, err)
+	}
+}
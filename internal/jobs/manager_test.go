@@ -0,0 +1,306 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T, workers, queueSize int) *Manager {
+	t.Helper()
+	m := NewManager(NewMemoryStore(), Config{
+		Workers:   workers,
+		QueueSize: queueSize,
+		Retention: time.Hour,
+		ResultDir: t.TempDir(),
+	})
+	t.Cleanup(func() { m.Stop(context.Background()) })
+	return m
+}
+
+// waitFinished polls a job until it reaches a terminal status
+func waitFinished(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.Status.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+// blockingRun returns a RunFunc that signals started and then waits for
+// release or its context
+func blockingRun(started chan<- struct{}, release <-chan struct{}) RunFunc {
+	return func(ctx context.Context, progress *Progress) error {
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// newInput creates an input file for a job
+func newInput(t *testing.T, m *Manager) string {
+	t.Helper()
+	f, err := m.CreateInput()
+	if err != nil {
+		t.Fatalf("CreateInput: %v", err)
+	}
+	f.Close()
+	return f.Name()
+}
+
+func expectRemoved(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("%s still exists: %v", path, err)
+	}
+}
+
+func TestManagerRunsJob(t *testing.T) {
+	m := newTestManager(t, 1, 10)
+	input := newInput(t, m)
+
+	job, err := m.Submit(context.Background(), Job{Type: "export", TenantID: 1, InputPath: input}, func(ctx context.Context, progress *Progress) error {
+		progress.SetTotal(3)
+		progress.Succeeded(2)
+		progress.Failed(3, "bad row")
+		result, err := progress.CreateResult("text/plain", "result.txt")
+		if err != nil {
+			return err
+		}
+		io.WriteString(result, "done")
+		return result.Close()
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.Status != StatusQueued || job.ID == "" {
+		t.Fatalf("submitted job %+v", job)
+	}
+
+	job = waitFinished(t, m, job.ID)
+	if job.Status != StatusSucceeded || job.Total != 3 || job.Processed != 3 || job.Succeeded != 2 || job.Failed != 1 {
+		t.Fatalf("finished job %+v", job)
+	}
+	if len(job.Errors) != 1 || job.Errors[0] != (Error{Line: 3, Message: "bad row"}) {
+		t.Fatalf("errors = %+v", job.Errors)
+	}
+	if job.StartedAt.IsZero() || job.FinishedAt.IsZero() {
+		t.Fatal("start and finish times not recorded")
+	}
+	content, err := os.ReadFile(job.ResultPath)
+	if err != nil || string(content) != "done" {
+		t.Fatalf("result = %q, %v", content, err)
+	}
+	if job.ResultContentType != "text/plain" || job.ResultFilename != "result.txt" {
+		t.Fatalf("result metadata %q, %q", job.ResultContentType, job.ResultFilename)
+	}
+	expectRemoved(t, input)
+}
+
+func TestManagerBoundsErrors(t *testing.T) {
+	m := newTestManager(t, 1, 10)
+	job, err := m.Submit(context.Background(), Job{Type: "import"}, func(ctx context.Context, progress *Progress) error {
+		for line := 1; line <= maxJobErrors+10; line++ {
+			progress.Failed(line, "bad row")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	job = waitFinished(t, m, job.ID)
+	if job.Failed != maxJobErrors+10 || len(job.Errors) != maxJobErrors {
+		t.Fatalf("failed %d with %d errors, want %d with %d", job.Failed, len(job.Errors), maxJobErrors+10, maxJobErrors)
+	}
+}
+
+func TestManagerFailedJobs(t *testing.T) {
+	m := newTestManager(t, 1, 10)
+	tests := map[string]RunFunc{
+		"error": func(ctx context.Context, progress *Progress) error {
+			result, err := progress.CreateResult("text/plain", "result.txt")
+			if err != nil {
+				return err
+			}
+			result.Close()
+			return errors.New("store unavailable")
+		},
+		"panic": func(ctx context.Context, progress *Progress) error {
+			panic("store unavailable")
+		},
+	}
+	for name, run := range tests {
+		t.Run(name, func(t *testing.T) {
+			job, err := m.Submit(context.Background(), Job{Type: "export"}, run)
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			job = waitFinished(t, m, job.ID)
+			if job.Status != StatusFailed || job.Message == "" {
+				t.Fatalf("job %+v, want failed with a message", job)
+			}
+			if job.ResultPath != "" {
+				t.Fatalf("failed job kept result %s", job.ResultPath)
+			}
+		})
+	}
+}
+
+func TestManagerQueueFull(t *testing.T) {
+	m := newTestManager(t, 1, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	if _, err := m.Submit(context.Background(), Job{Type: "export"}, blockingRun(started, release)); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+	if _, err := m.Submit(context.Background(), Job{Type: "export"}, blockingRun(make(chan struct{}), release)); err != nil {
+		t.Fatalf("Submit queued job: %v", err)
+	}
+
+	input := newInput(t, m)
+	_, err := m.Submit(context.Background(), Job{Type: "import", InputPath: input}, blockingRun(make(chan struct{}), release))
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err = %v, want ErrQueueFull", err)
+	}
+	expectRemoved(t, input)
+}
+
+func TestManagerCancel(t *testing.T) {
+	m := newTestManager(t, 1, 10)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+
+	running, err := m.Submit(context.Background(), Job{Type: "export"}, blockingRun(started, release))
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+
+	input := newInput(t, m)
+	queued, err := m.Submit(context.Background(), Job{Type: "import", InputPath: input}, func(ctx context.Context, progress *Progress) error {
+		t.Error("canceled job ran")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	// A queued job is canceled at once
+	job, err := m.Cancel(context.Background(), queued.ID)
+	if err != nil || job.Status != StatusCanceled {
+		t.Fatalf("Cancel queued job = %+v, %v", job, err)
+	}
+	expectRemoved(t, input)
+
+	// A running job is canceled once its RunFunc returns
+	if _, err := m.Cancel(context.Background(), running.ID); err != nil {
+		t.Fatalf("Cancel running job: %v", err)
+	}
+	if job := waitFinished(t, m, running.ID); job.Status != StatusCanceled {
+		t.Fatalf("running job status = %s, want canceled", job.Status)
+	}
+}
+
+func TestManagerStopCancelsQueuedJobs(t *testing.T) {
+	m := NewManager(NewMemoryStore(), Config{Workers: 1, QueueSize: 10, ResultDir: t.TempDir()})
+	started := make(chan struct{})
+
+	running, err := m.Submit(context.Background(), Job{Type: "export"}, blockingRun(started, nil))
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+
+	var queued []Job
+	for i := 0; i < 3; i++ {
+		input := newInput(t, m)
+		job, err := m.Submit(context.Background(), Job{Type: "import", InputPath: input}, func(ctx context.Context, progress *Progress) error {
+			t.Error("queued job ran after Stop")
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+		queued = append(queued, job)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	for _, job := range append(queued, running) {
+		got, err := m.Get(context.Background(), job.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got.Status != StatusCanceled || got.FinishedAt.IsZero() {
+			t.Fatalf("job %s is %s after Stop, want canceled", job.ID, got.Status)
+		}
+		if job.InputPath != "" {
+			expectRemoved(t, job.InputPath)
+		}
+	}
+}
+
+func TestManagerSweep(t *testing.T) {
+	m := newTestManager(t, 1, 10)
+	job, err := m.Submit(context.Background(), Job{Type: "export"}, func(ctx context.Context, progress *Progress) error {
+		result, err := progress.CreateResult("text/plain", "result.txt")
+		if err != nil {
+			return err
+		}
+		return result.Close()
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	job = waitFinished(t, m, job.ID)
+
+	// Jobs within retention are kept
+	m.sweep(time.Now())
+	if _, err := m.Get(context.Background(), job.ID); err != nil {
+		t.Fatalf("Get before retention: %v", err)
+	}
+
+	m.sweep(time.Now().Add(time.Hour + time.Minute))
+	if _, err := m.Get(context.Background(), job.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after retention = %v, want ErrNotFound", err)
+	}
+	expectRemoved(t, job.ResultPath)
+}
+
+func TestManagerDefaults(t *testing.T) {
+	m := NewManager(NewMemoryStore(), Config{})
+	defer m.Stop(context.Background())
+
+	if m.config.Workers != defaultWorkers || m.config.QueueSize != defaultQueueSize || m.config.Retention != defaultRetention {
+		t.Fatalf("config = %+v", m.config)
+	}
+	if m.config.ResultDir != os.TempDir() {
+		t.Fatalf("ResultDir = %q, want %q", m.config.ResultDir, os.TempDir())
+	}
+	if cap(m.queue) != defaultQueueSize {
+		t.Fatalf("queue capacity = %d, want %d", cap(m.queue), defaultQueueSize)
+	}
+}
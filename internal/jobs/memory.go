@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store
+type MemoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (m *MemoryStore) Put(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Errors = append([]Error(nil), job.Errors...)
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	job.Errors = append([]Error(nil), job.Errors...)
+	return job, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *MemoryStore) FinishedBefore(ctx context.Context, t time.Time) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var finished []Job
+	for _, job := range m.jobs {
+		if job.Status.Finished() && job.FinishedAt.Before(t) {
+			finished = append(finished, job)
+		}
+	}
+	return finished, nil
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/metrics"
+)
+
+// Progress records what a running job has done and saves it to the store,
+// at most once per progressSaveInterval while the job runs
+type Progress struct {
+	store     Store
+	resultDir string
+
+	mu       sync.Mutex
+	job      Job
+	lastSave time.Time
+}
+
+// ID returns the job's ID
+func (p *Progress) ID() string {
+	return p.job.ID
+}
+
+// SetTotal records how many items the job expects to process
+func (p *Progress) SetTotal(total int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Total = total
+	p.saveLocked(false)
+}
+
+// Succeeded records count items processed successfully
+func (p *Progress) Succeeded(count int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Processed += count
+	p.job.Succeeded += count
+	metrics.RecordJobItems(p.job.Type, "succeeded", count)
+	p.saveLocked(false)
+}
+
+// Failed records an item that could not be processed
+func (p *Progress) Failed(line int, message string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Processed++
+	p.job.Failed++
+	if len(p.job.Errors) < maxJobErrors {
+		p.job.Errors = append(p.job.Errors, Error{Line: line, Message: message})
+	}
+	metrics.RecordJobItems(p.job.Type, "failed", 1)
+	p.saveLocked(false)
+}
+
+// CreateResult creates the file that holds the job's output. It is removed
+// if the job does not succeed, and otherwise when the job expires.
+func (p *Progress) CreateResult(contentType, filename string) (*os.File, error) {
+	f, err := os.CreateTemp(p.resultDir, "job-"+p.job.ID+"-*")
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.job.ResultPath = f.Name()
+	p.job.ResultContentType = contentType
+	p.job.ResultFilename = filename
+	return f, nil
+}
+
+func (p *Progress) start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.job.Status = StatusRunning
+	p.job.StartedAt = time.Now()
+	p.saveLocked(true)
+}
+
+// finish records the outcome of the job's RunFunc. A job whose context was
+// canceled is reported as canceled whatever it returned.
+func (p *Progress) finish(runErr, ctxErr error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case ctxErr != nil:
+		p.job.Status = StatusCanceled
+	case runErr != nil:
+		p.job.Status = StatusFailed
+		p.job.Message = runErr.Error()
+	default:
+		p.job.Status = StatusSucceeded
+	}
+	if runErr != nil && !errors.Is(runErr, context.Canceled) {
+		log.Printf("Job %s (%s) failed: %v", p.job.ID, p.job.Type, runErr)
+	}
+
+	removeFile(p.job.ID, p.job.InputPath)
+	p.job.InputPath = ""
+	if p.job.Status != StatusSucceeded && p.job.ResultPath != "" {
+		removeFile(p.job.ID, p.job.ResultPath)
+		p.job.ResultPath, p.job.ResultContentType, p.job.ResultFilename = "", "", ""
+	}
+
+	p.job.FinishedAt = time.Now()
+	metrics.RecordJobFinished(p.job.Type, string(p.job.Status), p.job.FinishedAt.Sub(p.job.StartedAt).Seconds())
+	p.saveLocked(true)
+}
+
+func (p *Progress) saveLocked(force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.lastSave) < progressSaveInterval {
+		return
+	}
+	p.lastSave = now
+	if err := p.store.Put(context.Background(), p.job); err != nil {
+		log.Printf("Error saving progress of job %s: %v", p.job.ID, err)
+	}
+}
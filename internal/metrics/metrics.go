@@ -64,12 +64,111 @@ var (
 		},
 	)
 
+	// Security metrics
+	authorizationDeniedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "authorization_denied_total",
+			Help: "Total number of requests denied by route authorization policy",
+		},
+		[]string{"method", "endpoint", "permission"},
+	)
+
+	rateLimitedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limited_requests_total",
+			Help: "Total number of requests rejected by the per-tenant rate limit",
+		},
+		[]string{"tenant"},
+	)
+
+	// Job metrics
+	jobsSubmittedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jobs_submitted_total",
+			Help: "Total number of asynchronous jobs submitted",
+		},
+		[]string{"type"},
+	)
+
+	jobsFinishedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "jobs_finished_total",
+			Help: "Total number of asynchronous jobs finished",
+		},
+		[]string{"type", "status"},
+	)
+
+	jobsQueued = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jobs_queued",
+			Help: "Current number of jobs waiting for a worker",
+		},
+		[]string{"type"},
+	)
+
+	jobsRunning = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "jobs_running",
+			Help: "Current number of jobs being run",
+		},
+		[]string{"type"},
+	)
+
+	jobItemsProcessedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "job_items_processed_total",
+			Help: "Total number of items processed by asynchronous jobs",
+		},
+		[]string{"type", "outcome"},
+	)
+
+	jobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "job_duration_seconds",
+			Help:    "Asynchronous job run time in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.5, 2, 14),
+		},
+		[]string{"type"},
+	)
+
+	cacheLookupsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cache_lookups_total",
+			Help: "Total number of store read cache lookups",
+		},
+		[]string{"cache", "result"},
+	)
+
+	coalescedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coalesced_requests_total",
+			Help: "Total number of store reads that shared an identical in-flight call",
+		},
+		[]string{"method"},
+	)
+
+	circuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "store_circuit_breaker_state",
+			Help: "State of the circuit breaker for each store method (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"method"},
+	)
+
+	staleResponsesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "stale_responses_total",
+			Help: "Total number of store reads answered with a stale response because the store could not answer",
+		},
+		[]string{"method"},
+	)
+
 	grpcClientCallsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "grpc_client_calls_total",
-			Help: "Total number of gRPC client calls",
+			Help: "Total number of gRPC client calls, including retries and hedged calls",
 		},
-		[]string{"service", "method", "status_code"},
+		[]string{"service", "method", "status_code", "attempt"},
 	)
 
 	grpcClientCallDuration = prometheus.NewHistogramVec(
@@ -91,6 +190,18 @@ func init() {
 	prometheus.MustRegister(itemsRetrievedTotal)
 	prometheus.MustRegister(itemsUpdatedTotal)
 	prometheus.MustRegister(itemsDeletedTotal)
+	prometheus.MustRegister(authorizationDeniedTotal)
+	prometheus.MustRegister(rateLimitedRequestsTotal)
+	prometheus.MustRegister(jobsSubmittedTotal)
+	prometheus.MustRegister(jobsFinishedTotal)
+	prometheus.MustRegister(jobsQueued)
+	prometheus.MustRegister(jobsRunning)
+	prometheus.MustRegister(jobItemsProcessedTotal)
+	prometheus.MustRegister(jobDuration)
+	prometheus.MustRegister(cacheLookupsTotal)
+	prometheus.MustRegister(coalescedRequestsTotal)
+	prometheus.MustRegister(circuitBreakerState)
+	prometheus.MustRegister(staleResponsesTotal)
 	prometheus.MustRegister(grpcClientCallsTotal)
 	prometheus.MustRegister(grpcClientCallDuration)
 }
@@ -139,6 +250,12 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController, so
+// streaming handlers can flush through the wrapper
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Business metrics functions
 func RecordItemCreated() {
 	itemsCreatedTotal.Inc()
@@ -156,9 +273,73 @@ func RecordItemDeleted() {
 	itemsDeletedTotal.Inc()
 }
 
+// Security metrics functions
+func RecordAuthorizationDenied(method, endpoint, permission string) {
+	authorizationDeniedTotal.WithLabelValues(method, endpoint, permission).Inc()
+}
+
+func RecordRateLimited(tenant string) {
+	rateLimitedRequestsTotal.WithLabelValues(tenant).Inc()
+}
+
+// Job metrics functions
+func RecordJobSubmitted(jobType string) {
+	jobsSubmittedTotal.WithLabelValues(jobType).Inc()
+	jobsQueued.WithLabelValues(jobType).Inc()
+}
+
+func RecordJobStarted(jobType string) {
+	jobsQueued.WithLabelValues(jobType).Dec()
+	jobsRunning.WithLabelValues(jobType).Inc()
+}
+
+// RecordJobDropped records a job canceled before it started
+func RecordJobDropped(jobType string) {
+	jobsQueued.WithLabelValues(jobType).Dec()
+	jobsFinishedTotal.WithLabelValues(jobType, "canceled").Inc()
+}
+
+func RecordJobFinished(jobType, status string, duration float64) {
+	jobsRunning.WithLabelValues(jobType).Dec()
+	jobsFinishedTotal.WithLabelValues(jobType, status).Inc()
+	jobDuration.WithLabelValues(jobType).Observe(duration)
+}
+
+func RecordJobItems(jobType, outcome string, count int) {
+	jobItemsProcessedTotal.WithLabelValues(jobType, outcome).Add(float64(count))
+}
+
+// Cache metrics functions
+func RecordCacheHit(cache string) {
+	cacheLookupsTotal.WithLabelValues(cache, "hit").Inc()
+}
+
+func RecordCacheMiss(cache string) {
+	cacheLookupsTotal.WithLabelValues(cache, "miss").Inc()
+}
+
+// RecordCoalescedRequest records a store read that joined an identical call
+// already in flight
+func RecordCoalescedRequest(method string) {
+	coalescedRequestsTotal.WithLabelValues(method).Inc()
+}
+
+// SetCircuitBreakerState records the state of a store method's breaker
+func SetCircuitBreakerState(method string, state int) {
+	circuitBreakerState.WithLabelValues(method).Set(float64(state))
+}
+
+// RecordStaleServe records a store read answered from the stale fallback
+func RecordStaleServe(method string) {
+	staleResponsesTotal.WithLabelValues(method).Inc()
+}
+
 // gRPC client metrics functions
-func RecordGRPCClientCall(service, method, statusCode string) {
-	grpcClientCallsTotal.WithLabelValues(service, method, statusCode).Inc()
+
+// RecordGRPCClientCall records one call sent to a gRPC service; attempt is
+// "first", "retry" or "hedge"
+func RecordGRPCClientCall(service, method, statusCode, attempt string) {
+	grpcClientCallsTotal.WithLabelValues(service, method, statusCode, attempt).Inc()
 }
 
 func RecordGRPCClientCallDuration(service, method string, duration float64) {
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval controls how often idle buckets are purged
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	// updatedAt is when tokens was last brought up to date
+	updatedAt time.Time
+	// fullAt is when the bucket will be full again if left alone
+	fullAt time.Time
+}
+
+// MemoryLimiter is an in-process Limiter
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewMemoryLimiter creates a limiter with no buckets
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweepLocked(now)
+
+	burst := float64(limit.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst}
+		m.buckets[key] = b
+	} else {
+		b.tokens = math.Min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate)
+	}
+	b.updatedAt = now
+
+	result := Result{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.Rate)
+	}
+	b.fullAt = now.Add(secondsToDuration((burst - b.tokens) / limit.Rate))
+	result.Remaining = int(b.tokens)
+	result.ResetAfter = b.fullAt.Sub(now)
+	return result, nil
+}
+
+// sweepLocked drops buckets that have refilled, since a new full bucket is
+// indistinguishable from them
+func (m *MemoryLimiter) sweepLocked(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
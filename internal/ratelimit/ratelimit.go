@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests may be made at once, and the
+// bucket refills at Rate requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Window is how long an empty bucket takes to refill
+func (l Limit) Window() time.Duration {
+	return time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	Limit   Limit
+	// Remaining is the number of requests that could be made right now
+	Remaining int
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next request would be allowed; it is
+	// zero when Allowed is set
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from buckets identified by key. The in-memory
+// implementation limits each replica separately; a shared backend (e.g.
+// Redis with a Lua script) is needed to enforce one limit across replicas.
+type Limiter interface {
+	// Allow takes a token from the bucket for key, creating a full bucket
+	// sized by limit if there is none
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// ParsePlans parses per-plan limits written as "plan=rate:burst", separated
+// by commas, e.g. "free=5:10,pro=50:100". Rate is in requests per second.
+func ParsePlans(spec string) (map[string]Limit, error) {
+	plans := make(map[string]Limit)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		plan, value, ok := strings.Cut(entry, "=")
+		rate, burst, ok2 := strings.Cut(value, ":")
+		if !ok || !ok2 || plan == "" {
+			return nil, fmt.Errorf("invalid plan limit %q: want plan=rate:burst", entry)
+		}
+		r, err := strconv.ParseFloat(rate, 64)
+		if err != nil || r <= 0 {
+			return nil, fmt.Errorf("invalid rate in plan limit %q", entry)
+		}
+		b, err := strconv.Atoi(burst)
+		if err != nil || b < 1 {
+			return nil, fmt.Errorf("invalid burst in plan limit %q", entry)
+		}
+		plans[strings.TrimSpace(plan)] = Limit{Rate: r, Burst: b}
+	}
+	return plans, nil
+}
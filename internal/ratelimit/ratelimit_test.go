@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// rewind moves key's bucket back in time by d, as if d had passed
+func (m *MemoryLimiter) rewind(key string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if b, ok := m.buckets[key]; ok {
+		b.updatedAt = b.updatedAt.Add(-d)
+		b.fullAt = b.fullAt.Add(-d)
+	}
+}
+
+func allow(t *testing.T, m *MemoryLimiter, key string, limit Limit) Result {
+	t.Helper()
+	result, err := m.Allow(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	return result
+}
+
+func TestMemoryLimiterBurst(t *testing.T) {
+	m := NewMemoryLimiter()
+	limit := Limit{Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		result := allow(t, m, "tenant-1", limit)
+		if !result.Allowed || result.Remaining != i {
+			t.Fatalf("request %d: allowed %v, remaining %d, want remaining %d", 3-i, result.Allowed, result.Remaining, i)
+		}
+	}
+	result := allow(t, m, "tenant-1", limit)
+	if result.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Fatalf("RetryAfter = %v, want up to 1s", result.RetryAfter)
+	}
+	if result.ResetAfter <= 2*time.Second || result.ResetAfter > 3*time.Second {
+		t.Fatalf("ResetAfter = %v, want about 3s", result.ResetAfter)
+	}
+
+	// Buckets are kept per key
+	if !allow(t, m, "tenant-2", limit).Allowed {
+		t.Fatal("another key was limited")
+	}
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		allowed int
+	}{
+		{"no time", 0, 0},
+		{"less than a token", 400 * time.Millisecond, 0},
+		{"one token", 500 * time.Millisecond, 1},
+		{"two tokens", 1100 * time.Millisecond, 2},
+		{"capped at burst", time.Hour, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemoryLimiter()
+			limit := Limit{Rate: 2, Burst: 4}
+			for i := 0; i < limit.Burst; i++ {
+				allow(t, m, "key", limit)
+			}
+
+			m.rewind("key", tt.elapsed)
+			allowed := 0
+			for allow(t, m, "key", limit).Allowed {
+				allowed++
+			}
+			if allowed != tt.allowed {
+				t.Fatalf("allowed %d requests, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestParsePlans(t *testing.T) {
+	plans, err := ParsePlans(" free=5:10, pro=0.5:100 ,")
+	if err != nil {
+		t.Fatalf("ParsePlans: %v", err)
+	}
+	if plans["free"] != (Limit{Rate: 5, Burst: 10}) || plans["pro"] != (Limit{Rate: 0.5, Burst: 100}) || len(plans) != 2 {
+		t.Fatalf("ParsePlans = %v", plans)
+	}
+	if window := plans["free"].Window(); window != 2*time.Second {
+		t.Fatalf("Window = %v, want 2s", window)
+	}
+
+	for _, spec := range []string{"free", "free=5", "=5:10", "free=0:10", "free=x:10", "free=5:0", "free=5:x"} {
+		if _, err := ParsePlans(spec); err == nil {
+			t.Errorf("ParsePlans(%q) succeeded", spec)
+		}
+	}
+}
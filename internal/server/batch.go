@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/tracing"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// Batch limits
+const (
+	maxBatchOperations      = 1000
+	maxBatchBodyBytes       = 10 << 20
+	defaultBatchConcurrency = 8
+)
+
+// Batch operation kinds
+const (
+	batchOpCreate = "create"
+	batchOpUpdate = "update"
+	batchOpDelete = "delete"
+)
+
+type BatchRequest struct {
+	// Atomic applies all operations or none; applied operations are
+	// compensated if any operation fails
+	Atomic     bool              `json:"atomic"`
+	Operations []json.RawMessage `json:"operations"`
+}
+
+type BatchOperation struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Item json.RawMessage `json:"item"`
+}
+
+type BatchResult struct {
+	Index      int            `json:"index"`
+	Op         string         `json:"op"`
+	ID         string         `json:"id,omitempty"`
+	Status     int            `json:"status"`
+	Item       *ItemResponse  `json:"item,omitempty"`
+	Error      *ErrorResponse `json:"error,omitempty"`
+	RolledBack bool           `json:"rolled_back,omitempty"`
+}
+
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	// Committed is only reported for atomic batches
+	Committed *bool `json:"committed,omitempty"`
+}
+
+// batchTask is a validated operation ready to run against the store
+type batchTask struct {
+	index  int
+	op     string
+	id     string
+	create ItemRequest
+	update ItemUpdateRequest
+	// original is the item before the operation, kept for compensation
+	original *pb.Item
+	// applied is the item written by the operation
+	applied *pb.Item
+}
+
+// prefixFieldErrors scopes field errors to a location in the batch document
+func prefixFieldErrors(prefix string, fieldErrors []FieldError) []FieldError {
+	for i := range fieldErrors {
+		fieldErrors[i].Field = prefix + fieldErrors[i].Field
+	}
+	return fieldErrors
+}
+
+// parseBatchOperation decodes and validates one operation
+func parseBatchOperation(index int, raw json.RawMessage) (*batchTask, []FieldError) {
+	prefix := fmt.Sprintf("operations[%d].", index)
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+		return nil, []FieldError{{Field: fmt.Sprintf("operations[%d]", index), Message: "must be an object"}}
+	}
+	var op BatchOperation
+	if fieldErrors := assignJSONFields(fields, &op); len(fieldErrors) > 0 {
+		return nil, prefixFieldErrors(prefix, fieldErrors)
+	}
+
+	task := &batchTask{index: index, op: op.Op, id: op.ID}
+	v := newValidator(nil)
+	switch op.Op {
+	case batchOpCreate:
+		v.check(op.ID == "", "id", "must not be set for create")
+	case batchOpUpdate, batchOpDelete:
+		v.check(op.ID != "", "id", "is required for %s", op.Op)
+	default:
+		v.check(false, "op", "must be one of %s, %s, %s", batchOpCreate, batchOpUpdate, batchOpDelete)
+	}
+
+	hasItem := len(op.Item) > 0 && string(op.Item) != "null"
+	var itemFields map[string]json.RawMessage
+	if op.Op == batchOpCreate || op.Op == batchOpUpdate {
+		if err := json.Unmarshal(op.Item, &itemFields); !hasItem || err != nil || itemFields == nil {
+			v.check(false, "item", "must be an object")
+		}
+	} else if op.Op == batchOpDelete {
+		v.check(!hasItem, "item", "must not be set for delete")
+	}
+
+	fieldErrors := v.errors
+	if itemFields != nil {
+		var itemErrors []FieldError
+		if op.Op == batchOpCreate {
+			itemErrors = task.create.validate(assignJSONFields(itemFields, &task.create))
+		} else {
+			itemErrors = task.update.validate(assignJSONFields(itemFields, &task.update))
+		}
+		fieldErrors = append(fieldErrors, prefixFieldErrors("item.", itemErrors)...)
+	}
+	if len(fieldErrors) > 0 {
+		return nil, prefixFieldErrors(prefix, fieldErrors)
+	}
+	return task, nil
+}
+
+// runBounded calls fn for each task with at most limit calls in flight
+func runBounded(tasks []*batchTask, limit int, fn func(*batchTask)) {
+	semaphore := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(task *batchTask) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fn(task)
+		}(task)
+	}
+	wg.Wait()
+}
+
+// BatchItems applies many create, update and delete operations in one request
+// and reports a result per operation with 207 Multi-Status
+func (s *Server) BatchItems(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.batch_items")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("BatchItems called with canary PR: %s", canary)
+	}
+
+	body, err := readBody(w, r, maxBatchBodyBytes)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body must be a JSON object")
+		return
+	}
+	var req BatchRequest
+	if fieldErrors := assignJSONFields(fields, &req); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBatchOperations {
+		writeValidationErrors(w, r, []FieldError{{
+			Field:   "operations",
+			Message: fmt.Sprintf("must contain between 1 and %d operations", maxBatchOperations),
+		}})
+		return
+	}
+
+	results := make([]BatchResult, len(req.Operations))
+	var tasks []*batchTask
+	var allErrors []FieldError
+	seenIDs := make(map[string]int)
+	for i, raw := range req.Operations {
+		task, fieldErrors := parseBatchOperation(i, raw)
+		if task != nil && task.id != "" {
+			if first, dup := seenIDs[task.id]; dup {
+				fieldErrors = []FieldError{{
+					Field:   fmt.Sprintf("operations[%d].id", i),
+					Message: fmt.Sprintf("duplicates the id of operations[%d]", first),
+				}}
+				task = nil
+			} else {
+				seenIDs[task.id] = i
+			}
+		}
+		if task == nil {
+			allErrors = append(allErrors, fieldErrors...)
+			problem := newProblem(r, http.StatusUnprocessableEntity, CodeValidationFailed, "Operation validation failed")
+			problem.Errors = fieldErrors
+			results[i] = BatchResult{Index: i, Status: problem.Status, Error: &problem}
+			continue
+		}
+		results[i] = BatchResult{Index: i, Op: task.op, ID: task.id}
+		tasks = append(tasks, task)
+	}
+
+	if req.Atomic && len(allErrors) > 0 {
+		writeValidationErrors(w, r, allErrors)
+		return
+	}
+
+	tenantID := getTenantIDFromRequest(r)
+	userID := getUserFromRequest(r)
+	r = r.WithContext(ctx)
+
+	var committed *bool
+	if req.Atomic {
+		ok := s.runAtomicBatch(r, tenantID, userID, tasks, results)
+		committed = &ok
+	} else {
+		runBounded(tasks, s.batchConcurrency, func(task *batchTask) {
+			results[task.index] = s.runBatchTask(r, tenantID, userID, task)
+		})
+	}
+
+	response := BatchResponse{Results: results, Committed: committed}
+	for _, result := range results {
+		if result.Error == nil && !result.RolledBack {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(response)
+}
+
+// runBatchTask applies one operation and records the written item on the task
+func (s *Server) runBatchTask(r *http.Request, tenantID int64, userID string, task *batchTask) BatchResult {
+	result := BatchResult{Index: task.index, Op: task.op, ID: task.id}
+
+	// Each operation is a separate write under the request's idempotency key
+	ctx := client.WithIdempotencyKeySuffix(r.Context(), strconv.Itoa(task.index))
+
+	var err error
+	var message string
+	switch task.op {
+	case batchOpCreate:
+		task.applied, err = s.createItem(ctx, tenantID, userID, task.create)
+		result.Status, message = http.StatusCreated, "Failed to create item"
+	case batchOpUpdate:
+		task.applied, err = s.updateItem(ctx, tenantID, userID, task.id, task.update)
+		result.Status, message = http.StatusOK, "Failed to update item"
+	case batchOpDelete:
+		err = s.deleteItem(ctx, tenantID, task.id)
+		result.Status, message = http.StatusNoContent, "Failed to delete item"
+	}
+
+	if err != nil {
+		log.Printf("Error applying batch operation %d: %v", task.index, err)
+		problem, _ := storeErrorProblem(r, err, message)
+		result.Status, result.Error = problem.Status, &problem
+		return result
+	}
+	if task.applied != nil {
+		response := protoItemToResponse(task.applied)
+		result.ID, result.Item = task.applied.Id, &response
+	}
+	return result
+}
+
+// runAtomicBatch applies every task or, if any fails, compensates the ones
+// that were applied. The store has no transactions, so compensation is best
+// effort: a deleted item is recreated under a new ID, and a concurrent writer
+// can observe intermediate states.
+func (s *Server) runAtomicBatch(r *http.Request, tenantID int64, userID string, tasks []*batchTask, results []BatchResult) bool {
+	notExecuted := func(task *batchTask) BatchResult {
+		problem := newProblem(r, http.StatusFailedDependency, CodeBatchAborted, "Not applied because another operation failed")
+		return BatchResult{Index: task.index, Op: task.op, ID: task.id, Status: problem.Status, Error: &problem}
+	}
+
+	// Capture originals so updates and deletes can be undone
+	var failed bool
+	var mu sync.Mutex
+	runBounded(tasks, s.batchConcurrency, func(task *batchTask) {
+		if task.op == batchOpCreate {
+			return
+		}
+		original, err := s.storeClient.GetItem(client.BypassCache(r.Context()), tenantID, task.id)
+		if err != nil {
+			problem, _ := storeErrorProblem(r, err, "Failed to get item")
+			mu.Lock()
+			failed = true
+			results[task.index] = BatchResult{Index: task.index, Op: task.op, ID: task.id, Status: problem.Status, Error: &problem}
+			mu.Unlock()
+			return
+		}
+		task.original = original
+	})
+	if failed {
+		for _, task := range tasks {
+			if results[task.index].Error == nil {
+				results[task.index] = notExecuted(task)
+			}
+		}
+		return false
+	}
+
+	runBounded(tasks, s.batchConcurrency, func(task *batchTask) {
+		result := s.runBatchTask(r, tenantID, userID, task)
+		mu.Lock()
+		failed = failed || result.Error != nil
+		results[task.index] = result
+		mu.Unlock()
+	})
+	if !failed {
+		return true
+	}
+
+	// Compensation must run even if the client has gone away
+	compensateRequest := r.WithContext(context.WithoutCancel(r.Context()))
+	runBounded(tasks, s.batchConcurrency, func(task *batchTask) {
+		if results[task.index].Error != nil {
+			return
+		}
+		ctx := client.WithIdempotencyKeySuffix(compensateRequest.Context(), strconv.Itoa(task.index)+"/rollback")
+		var err error
+		switch task.op {
+		case batchOpCreate:
+			err = s.deleteItem(ctx, tenantID, task.applied.Id)
+		case batchOpUpdate:
+			_, err = s.updateItem(ctx, tenantID, userID, task.id, itemToUpdateRequest(task.original))
+		case batchOpDelete:
+			var restored *pb.Item
+			if restored, err = s.createItem(ctx, tenantID, task.original.CreatedBy, itemToCreateRequest(task.original)); err == nil {
+				response := protoItemToResponse(restored)
+				results[task.index].Item = &response
+				results[task.index].ID = restored.Id
+			}
+		}
+		if err != nil {
+			log.Printf("Error compensating batch operation %d: %v", task.index, err)
+			problem, _ := storeErrorProblem(r, err, "Failed to roll back operation")
+			problem.Type, problem.Code = problemTypePrefix+CodeRollbackFailed, CodeRollbackFailed
+			results[task.index].Error = &problem
+			return
+		}
+		results[task.index].RolledBack = true
+	})
+	return false
+}
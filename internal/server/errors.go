@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rinsecrm/api-service/internal/tracing"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix namespaces the problem type URIs derived from error codes
+const problemTypePrefix = "urn:rinsecrm:problem:"
+
+// Machine-readable error codes reported in ErrorResponse.Code
+const (
+	CodeInvalidJSON           = "invalid_json"
+	CodeValidationFailed      = "validation_failed"
+	CodePayloadTooLarge       = "payload_too_large"
+	CodeUnsupportedMediaType  = "unsupported_media_type"
+	CodePatchFailed           = "patch_failed"
+	CodePatchTestFailed       = "patch_test_failed"
+	CodeInvalidIdempotencyKey = "invalid_idempotency_key"
+	CodeInvalidRequestTimeout = "invalid_request_timeout"
+	CodeIdempotencyKeyInUse   = "idempotency_key_in_use"
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeETagMismatch          = "etag_mismatch"
+	CodeBatchAborted          = "batch_aborted"
+	CodeInvalidQuery          = "invalid_query"
+	CodeInvalidCursor         = "invalid_cursor"
+	CodeJobQueueFull          = "job_queue_full"
+	CodeJobFinished           = "job_finished"
+	CodeJobResultUnavailable  = "job_result_unavailable"
+	CodeMalformedRow          = "malformed_row"
+	CodeRollbackFailed        = "rollback_failed"
+	CodeUnauthenticated       = "unauthenticated"
+	CodeForbidden             = "forbidden"
+	CodeNotFound              = "not_found"
+	CodeMethodNotAllowed      = "method_not_allowed"
+	CodeInternal              = "internal"
+	CodeInvalidArgument       = "invalid_argument"
+	CodeOutOfRange            = "out_of_range"
+	CodeAlreadyExists         = "already_exists"
+	CodeAborted               = "aborted"
+	CodePreconditionFail      = "failed_precondition"
+	CodePermissionDenied      = "permission_denied"
+	CodeUnavailable           = "unavailable"
+	CodeDeadlineExceeded      = "deadline_exceeded"
+	CodeResourceExhausted     = "resource_exhausted"
+	CodeRateLimited           = "rate_limited"
+	CodeUnimplemented         = "unimplemented"
+)
+
+// ErrorResponse is an RFC 7807 problem details document, extended with a
+// machine-readable code, the trace ID and per-field validation errors
+type ErrorResponse struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	TraceID  string       `json:"trace_id,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Details  []string     `json:"details,omitempty"`
+}
+
+// FieldError describes a problem with a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// grpcStatusMapping translates store-service gRPC codes into HTTP status codes
+// and the machine-readable code reported in ErrorResponse
+var grpcStatusMapping = map[codes.Code]struct {
+	httpStatus int
+	code       string
+}{
+	codes.NotFound:           {http.StatusNotFound, CodeNotFound},
+	codes.InvalidArgument:    {http.StatusBadRequest, CodeInvalidArgument},
+	codes.OutOfRange:         {http.StatusBadRequest, CodeOutOfRange},
+	codes.AlreadyExists:      {http.StatusConflict, CodeAlreadyExists},
+	codes.Aborted:            {http.StatusConflict, CodeAborted},
+	codes.FailedPrecondition: {http.StatusPreconditionFailed, CodePreconditionFail},
+	codes.PermissionDenied:   {http.StatusForbidden, CodePermissionDenied},
+	codes.Unavailable:        {http.StatusServiceUnavailable, CodeUnavailable},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, CodeDeadlineExceeded},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, CodeResourceExhausted},
+	codes.Unimplemented:      {http.StatusNotImplemented, CodeUnimplemented},
+}
+
+// newProblem builds an ErrorResponse for the request with the standard members filled in
+func newProblem(r *http.Request, statusCode int, code, detail string) ErrorResponse {
+	return newProblemAt(r.Context(), r.URL.Path, statusCode, code, detail)
+}
+
+// newProblemAt builds an ErrorResponse about instance, for work such as a
+// job that outlives the request it came from
+func newProblemAt(ctx context.Context, instance string, statusCode int, code, detail string) ErrorResponse {
+	return ErrorResponse{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(statusCode),
+		Status:   statusCode,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+		TraceID:  tracing.TraceIDFromContext(ctx),
+	}
+}
+
+// writeProblem writes an application/problem+json response
+func writeProblem(w http.ResponseWriter, problem ErrorResponse) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, statusCode int, code, detail string) {
+	writeProblem(w, newProblem(r, statusCode, code, detail))
+}
+
+// grpcStatusFromError converts a StoreClient error into a gRPC status,
+// treating local context cancellation like its gRPC equivalent
+func grpcStatusFromError(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err)
+	}
+	return status.Convert(err)
+}
+
+// storeErrorProblem builds the ErrorResponse for a failed StoreClient call
+// using the HTTP status that corresponds to the gRPC code. retryAfter is set
+// when the store supplied a RetryInfo detail.
+func storeErrorProblem(r *http.Request, err error, message string) (problem ErrorResponse, retryAfter time.Duration) {
+	return storeErrorProblemAt(r.Context(), r.URL.Path, err, message)
+}
+
+// storeErrorProblemAt is storeErrorProblem for a problem about instance
+func storeErrorProblemAt(ctx context.Context, instance string, err error, message string) (problem ErrorResponse, retryAfter time.Duration) {
+	st := grpcStatusFromError(err)
+
+	statusCode, code := http.StatusInternalServerError, CodeInternal
+	if mapping, ok := grpcStatusMapping[st.Code()]; ok {
+		statusCode, code = mapping.httpStatus, mapping.code
+	}
+
+	problem = newProblemAt(ctx, instance, statusCode, code, message)
+	if st.Message() != "" {
+		problem.Detail = fmt.Sprintf("%s: %s", message, st.Message())
+	}
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range d.GetFieldViolations() {
+				problem.Errors = append(problem.Errors, FieldError{Field: violation.GetField(), Message: violation.GetDescription()})
+			}
+		case *errdetails.PreconditionFailure:
+			for _, violation := range d.GetViolations() {
+				problem.Details = append(problem.Details, fmt.Sprintf("%s %s: %s", violation.GetType(), violation.GetSubject(), violation.GetDescription()))
+			}
+		case *errdetails.QuotaFailure:
+			for _, violation := range d.GetViolations() {
+				problem.Details = append(problem.Details, fmt.Sprintf("%s: %s", violation.GetSubject(), violation.GetDescription()))
+			}
+		case *errdetails.ErrorInfo:
+			problem.Details = append(problem.Details, d.GetReason())
+		case *errdetails.LocalizedMessage:
+			problem.Details = append(problem.Details, d.GetMessage())
+		case *errdetails.RetryInfo:
+			retryAfter = d.GetRetryDelay().AsDuration()
+		}
+	}
+	return problem, retryAfter
+}
+
+// writeStoreError writes an ErrorResponse for a failed StoreClient call
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	problem, retryAfter := storeErrorProblem(r, err, message)
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	writeProblem(w, problem)
+}
+
+// NotFound reports unmatched routes as a problem document
+func (s *Server) NotFound(w http.ResponseWriter, r *http.Request) {
+	writeErrorResponse(w, r, http.StatusNotFound, CodeNotFound, "No route matches "+r.URL.Path)
+}
+
+// MethodNotAllowed reports a method mismatch on a known route as a problem document
+func (s *Server) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeErrorResponse(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, r.Method+" is not supported on "+r.URL.Path)
+}
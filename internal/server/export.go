@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/tracing"
+	"github.com/rinsecrm/api-service/internal/xlsx"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// Export formats
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+	exportFormatXLSX   = "xlsx"
+)
+
+// exportPageSize is the page size used to walk the catalog
+const exportPageSize = 100
+
+// exportColumns are the CSV and XLSX columns; they use the item field names
+// so an export can be imported again
+var exportColumns = []string{
+	"id", "name", "description", "price", "category", "status", "sku",
+	"inventory_count", "tags", "created_at", "updated_at", "created_by", "updated_by",
+}
+
+// itemEncoder writes items in one export format
+type itemEncoder interface {
+	encode(item *pb.Item) error
+	// flush pushes encoded items towards the client
+	flush() error
+	close() error
+}
+
+// exportColumnsFor returns the indexes of the exportColumns selected by
+// fields
+func exportColumnsFor(fields fieldSet) []int {
+	var columns []int
+	for i, column := range exportColumns {
+		if fields.includes(column) {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+// exportRow renders item as the cells of the given exportColumns. Unspecified
+// categories and statuses are left empty, as the import expects.
+func exportRow(item *pb.Item, columns []int) []interface{} {
+	fields := itemToUpdateRequest(item)
+	response := protoItemToResponse(item)
+	cells := []interface{}{
+		response.ID, response.Name, response.Description, response.Price,
+		fields.Category, fields.Status, response.SKU, response.InventoryCount,
+		strings.Join(response.Tags, ","), response.CreatedAt, response.UpdatedAt,
+		response.CreatedBy, response.UpdatedBy,
+	}
+
+	row := make([]interface{}, len(columns))
+	for i, column := range columns {
+		row[i] = cells[column]
+	}
+	return row
+}
+
+// columnHeader returns the names of the given exportColumns
+func columnHeader(columns []int) []string {
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = exportColumns[column]
+	}
+	return header
+}
+
+// formulaPrefixes are the leading characters that make a CSV cell a formula
+const formulaPrefixes = "=+-@"
+
+type csvItemEncoder struct {
+	writer  *csv.Writer
+	columns []int
+}
+
+func newCSVItemEncoder(w io.Writer, columns []int) (*csvItemEncoder, error) {
+	writer := csv.NewWriter(w)
+	return &csvItemEncoder{writer: writer, columns: columns}, writer.Write(columnHeader(columns))
+}
+
+func (e *csvItemEncoder) encode(item *pb.Item) error {
+	row := exportRow(item, e.columns)
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			record[i] = escapeFormula(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return e.writer.Write(record)
+}
+
+// escapeFormula prefixes text that a spreadsheet would evaluate as a formula
+// with a quote, so that opening an export cannot run user-supplied formulas.
+// Text the import would unescape is quoted too, so every cell round-trips.
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune(formulaPrefixes, rune(text[0])) || unescapeFormula(text) != text {
+		return "'" + text
+	}
+	return text
+}
+
+func (e *csvItemEncoder) flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+func (e *csvItemEncoder) close() error {
+	return e.flush()
+}
+
+type ndjsonItemEncoder struct {
+	encoder *json.Encoder
+	fields  fieldSet
+}
+
+func (e *ndjsonItemEncoder) encode(item *pb.Item) error {
+	return e.encoder.Encode(protoItemToResponse(item).selectFields(e.fields))
+}
+
+func (e *ndjsonItemEncoder) flush() error { return nil }
+
+func (e *ndjsonItemEncoder) close() error { return nil }
+
+type xlsxItemEncoder struct {
+	writer  *xlsx.Writer
+	columns []int
+}
+
+func newXLSXItemEncoder(w io.Writer, columns []int) (*xlsxItemEncoder, error) {
+	writer, err := xlsx.NewWriter(w, "Items")
+	if err != nil {
+		return nil, err
+	}
+	var header []interface{}
+	for _, column := range columnHeader(columns) {
+		header = append(header, column)
+	}
+	return &xlsxItemEncoder{writer: writer, columns: columns}, writer.WriteRow(header...)
+}
+
+func (e *xlsxItemEncoder) encode(item *pb.Item) error {
+	return e.writer.WriteRow(exportRow(item, e.columns)...)
+}
+
+func (e *xlsxItemEncoder) flush() error {
+	return e.writer.Flush()
+}
+
+func (e *xlsxItemEncoder) close() error {
+	return e.writer.Close()
+}
+
+// exportContentType returns the media type of format, or false if the
+// format is not supported
+func exportContentType(format string) (string, bool) {
+	switch format {
+	case exportFormatCSV:
+		return "text/csv; charset=utf-8", true
+	case exportFormatNDJSON:
+		return ndjsonContentType, true
+	case exportFormatXLSX:
+		return xlsx.ContentType, true
+	}
+	return "", false
+}
+
+func newItemEncoder(format string, w io.Writer, fields fieldSet) (itemEncoder, error) {
+	switch format {
+	case exportFormatCSV:
+		return newCSVItemEncoder(w, exportColumnsFor(fields))
+	case exportFormatNDJSON:
+		return &ndjsonItemEncoder{encoder: json.NewEncoder(w), fields: fields}, nil
+	default:
+		return newXLSXItemEncoder(w, exportColumnsFor(fields))
+	}
+}
+
+// parseExportQuery validates the filters and fields of an export. CSV and
+// XLSX exports must keep at least one column, and exports are not sorted.
+func parseExportQuery(r *http.Request, format string) (listFilters, fieldSet, []FieldError) {
+	filters, fieldErrors := parseListFilters(r)
+	fields, fieldSetErrors := parseFieldSet(r)
+	v := newValidator(append(fieldErrors, fieldSetErrors...))
+	// Sorting needs the whole listing in memory, which an export of any size
+	// cannot afford
+	v.check(len(filters.sort) == 0, "sort", "is not supported for exports")
+	if len(fieldSetErrors) == 0 && format != exportFormatNDJSON {
+		v.check(len(exportColumnsFor(fields)) > 0, "fields", "must include one of %s", strings.Join(exportColumns, ", "))
+	}
+	return filters, fields, v.errors
+}
+
+// exportFormatFromRequest reads the format query parameter, defaulting to CSV
+func exportFormatFromRequest(r *http.Request) (string, []FieldError) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if _, ok := exportContentType(format); !ok {
+		return "", []FieldError{{
+			Field:   "format",
+			Message: fmt.Sprintf("must be one of %s, %s, %s", exportFormatCSV, exportFormatNDJSON, exportFormatXLSX),
+		}}
+	}
+	return format, nil
+}
+
+// exportFilename names the download of an export
+func exportFilename(tenantID int64, format string) string {
+	return fmt.Sprintf("items-%d-%s.%s", tenantID, time.Now().UTC().Format("20060102T150405Z"), format)
+}
+
+// writeExport encodes items, which must be the first page of the listing,
+// and every following page. afterPage is called once a page is encoded with
+// the number of items on it.
+func (s *Server) writeExport(ctx context.Context, tenantID int64, filters listFilters, encoder itemEncoder, page itemPage, afterPage func(count int) error) error {
+	for {
+		for _, item := range page.items {
+			if err := encoder.encode(item); err != nil {
+				return err
+			}
+		}
+		if err := encoder.flush(); err != nil {
+			return err
+		}
+		if err := afterPage(len(page.items)); err != nil {
+			return err
+		}
+		if page.next == nil {
+			return encoder.close()
+		}
+
+		var err error
+		page, err = s.listItems(ctx, tenantID, filters, exportPageSize, *page.next)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ExportItems streams every item matching the ListItems filters as CSV,
+// NDJSON or XLSX, fetching one page at a time so memory stays flat
+func (s *Server) ExportItems(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.export_items")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("ExportItems called with canary PR: %s", canary)
+	}
+
+	format, fieldErrors := exportFormatFromRequest(r)
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+	contentType, _ := exportContentType(format)
+
+	filters, fields, fieldErrors := parseExportQuery(r, format)
+	if len(fieldErrors) > 0 {
+		writeQueryErrors(w, r, fieldErrors)
+		return
+	}
+	tenantID := getTenantIDFromRequest(r)
+
+	// The first page is fetched before anything is written, so that a
+	// failing store can still be reported as a problem response
+	page, err := s.listItems(ctx, tenantID, filters, exportPageSize, listCursor{})
+	if err != nil {
+		writeListError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", exportFilename(tenantID, format)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	controller := http.NewResponseController(w)
+	exported := 0
+	encoder, err := newItemEncoder(format, w, fields)
+	if err == nil {
+		err = s.writeExport(ctx, tenantID, filters, encoder, page, func(count int) error {
+			exported += count
+			if err := controller.Flush(); !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	// Once the status line is sent, errors can only be signalled by aborting
+	// the response, so clients see a truncated transfer rather than a
+	// complete-looking file
+	if err != nil {
+		log.Printf("Export aborted after %d items: %v", exported, err)
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// itemFieldNames are the JSON names of the ItemResponse fields, in order
+var itemFieldNames = jsonFieldNames(reflect.TypeOf(ItemResponse{}))
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if t.Field(i).IsExported() && name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldSet is the sparse fieldset selected with the fields parameter. A nil
+// fieldSet selects every field.
+type fieldSet map[string]bool
+
+// parseFieldSet validates the comma-separated fields parameter
+func parseFieldSet(r *http.Request) (fieldSet, []FieldError) {
+	names := queryList(r.URL.Query()["fields"])
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	fields := make(fieldSet, len(names))
+	v := newValidator(nil)
+	for _, name := range names {
+		known := false
+		for _, fieldName := range itemFieldNames {
+			known = known || name == fieldName
+		}
+		v.check(known, "fields", "must be a comma-separated list of %s", strings.Join(itemFieldNames, ", "))
+		fields[name] = true
+	}
+	return fields, v.errors
+}
+
+func (f fieldSet) includes(name string) bool {
+	return f == nil || f[name]
+}
+
+// selectFields trims response to the fields in f
+func (r ItemResponse) selectFields(f fieldSet) ItemResponse {
+	r.fields = f
+	return r
+}
+
+// MarshalJSON leaves out the fields not selected by selectFields
+func (r ItemResponse) MarshalJSON() ([]byte, error) {
+	type plain ItemResponse
+	data, err := json.Marshal(plain(r))
+	if err != nil || r.fields == nil {
+		return data, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, name := range itemFieldNames {
+		if !r.fields[name] {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(values[name])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
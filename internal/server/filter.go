@@ -0,0 +1,272 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// Values of the tags_match parameter
+const (
+	tagsMatchAny = "any"
+	tagsMatchAll = "all"
+)
+
+// sortFields maps the fields accepted by the sort parameter to a comparison
+// of two items, negative when a sorts first
+var sortFields = map[string]func(a, b *pb.Item) int{
+	"name":            func(a, b *pb.Item) int { return strings.Compare(a.Name, b.Name) },
+	"sku":             func(a, b *pb.Item) int { return strings.Compare(a.Sku, b.Sku) },
+	"price":           func(a, b *pb.Item) int { return compareFloat(a.Price, b.Price) },
+	"inventory_count": func(a, b *pb.Item) int { return int(a.InventoryCount) - int(b.InventoryCount) },
+	"created_at":      func(a, b *pb.Item) int { return a.CreatedAt.AsTime().Compare(b.CreatedAt.AsTime()) },
+	"updated_at":      func(a, b *pb.Item) int { return a.UpdatedAt.AsTime().Compare(b.UpdatedAt.AsTime()) },
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+// listFilters select the items of a listing. categories, statuses and search
+// are passed to the store; the rest is applied by the API over the store's
+// pages.
+type listFilters struct {
+	// categories and statuses are sorted; empty means any
+	categories []pb.ItemCategory
+	statuses   []pb.ItemStatus
+	search     string
+
+	minPrice     *float64
+	maxPrice     *float64
+	tags         []string
+	allTags      bool
+	sku          string
+	createdAfter time.Time
+	updatedAfter time.Time
+
+	sort []sortKey
+}
+
+// parseListFilters validates the filter and sort parameters shared by
+// listing and export
+func parseListFilters(r *http.Request) (listFilters, []FieldError) {
+	query := r.URL.Query()
+	filters := listFilters{
+		search: query.Get("search"),
+		sku:    query.Get("sku"),
+	}
+	v := newValidator(nil)
+
+	for _, category := range queryList(query["category"]) {
+		parsed, ok := parseCategory(category)
+		v.check(ok, "category", "must be a comma-separated list of %s", strings.Join(categoryNames, ", "))
+		if ok && !slices.Contains(filters.categories, parsed) {
+			filters.categories = append(filters.categories, parsed)
+		}
+	}
+	slices.Sort(filters.categories)
+	for _, status := range queryList(query["status"]) {
+		parsed, ok := parseStatus(status)
+		v.check(ok, "status", "must be a comma-separated list of %s", strings.Join(statusNames, ", "))
+		if ok && !slices.Contains(filters.statuses, parsed) {
+			filters.statuses = append(filters.statuses, parsed)
+		}
+	}
+	slices.Sort(filters.statuses)
+
+	parsePrice := func(field string) *float64 {
+		raw := query.Get(field)
+		if raw == "" {
+			return nil
+		}
+		price, err := strconv.ParseFloat(raw, 64)
+		v.check(err == nil && price >= 0, field, "must be a non-negative number")
+		return &price
+	}
+	filters.minPrice = parsePrice("min_price")
+	filters.maxPrice = parsePrice("max_price")
+	if filters.minPrice != nil && filters.maxPrice != nil {
+		v.check(*filters.minPrice <= *filters.maxPrice, "max_price", "must not be less than min_price")
+	}
+
+	filters.tags = queryList([]string{query.Get("tags")})
+	switch query.Get("tags_match") {
+	case "", tagsMatchAny:
+	case tagsMatchAll:
+		filters.allTags = true
+	default:
+		v.check(false, "tags_match", "must be one of %s, %s", tagsMatchAny, tagsMatchAll)
+	}
+
+	parseTime := func(field string) time.Time {
+		raw := query.Get(field)
+		if raw == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		v.check(err == nil, field, "must be an RFC 3339 timestamp")
+		return t
+	}
+	filters.createdAfter = parseTime("created_after")
+	filters.updatedAfter = parseTime("updated_after")
+
+	if raw := query.Get("sort"); raw != "" {
+		seen := make(map[string]bool)
+		for _, field := range strings.Split(raw, ",") {
+			key := sortKey{field: strings.TrimSpace(field)}
+			if strings.HasPrefix(key.field, "-") {
+				key.field, key.descending = key.field[1:], true
+			}
+			if _, ok := sortFields[key.field]; !ok || seen[key.field] {
+				v.check(false, "sort", "must be a comma-separated list of distinct fields from %s, each optionally prefixed with -",
+					strings.Join(sortFieldNames(), ", "))
+				break
+			}
+			seen[key.field] = true
+			filters.sort = append(filters.sort, key)
+		}
+	}
+
+	return filters, v.errors
+}
+
+// queryList splits the values of a repeatable, comma-separated parameter,
+// dropping empty entries
+func queryList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+	}
+	return list
+}
+
+func sortFieldNames() []string {
+	names := make([]string, 0, len(sortFields))
+	for name := range sortFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scope identifies the listing a cursor continues; a cursor is only
+// accepted with the filters it was issued for
+func (f listFilters) scope() string {
+	formatPrice := func(price *float64) string {
+		if price == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*price, 'g', -1, 64)
+	}
+	return fmt.Sprintf("%v|%v|%q|%s|%s|%q|%t|%q|%d|%d|%v",
+		f.categories, f.statuses, f.search,
+		formatPrice(f.minPrice), formatPrice(f.maxPrice), f.tags, f.allTags, f.sku,
+		f.createdAfter.UnixNano(), f.updatedAfter.UnixNano(), f.sort)
+}
+
+// listShard is one store query of a listing. A listing with several
+// categories or statuses is read as one shard per combination.
+type listShard struct {
+	category pb.ItemCategory
+	status   pb.ItemStatus
+}
+
+func (f listFilters) shards() []listShard {
+	categories := f.categories
+	if len(categories) == 0 {
+		categories = []pb.ItemCategory{pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED}
+	}
+	statuses := f.statuses
+	if len(statuses) == 0 {
+		statuses = []pb.ItemStatus{pb.ItemStatus_ITEM_STATUS_UNSPECIFIED}
+	}
+
+	var shards []listShard
+	for _, category := range categories {
+		for _, status := range statuses {
+			shards = append(shards, listShard{category: category, status: status})
+		}
+	}
+	return shards
+}
+
+// filtersItems reports whether any filter must be applied by the API
+func (f listFilters) filtersItems() bool {
+	return f.minPrice != nil || f.maxPrice != nil || len(f.tags) > 0 || f.sku != "" ||
+		!f.createdAfter.IsZero() || !f.updatedAfter.IsZero()
+}
+
+// matches applies the filters the store cannot
+func (f listFilters) matches(item *pb.Item) bool {
+	if f.minPrice != nil && item.Price < *f.minPrice {
+		return false
+	}
+	if f.maxPrice != nil && item.Price > *f.maxPrice {
+		return false
+	}
+	if f.sku != "" && item.Sku != f.sku {
+		return false
+	}
+	if !f.createdAfter.IsZero() && !item.CreatedAt.AsTime().After(f.createdAfter) {
+		return false
+	}
+	if !f.updatedAfter.IsZero() && !item.UpdatedAt.AsTime().After(f.updatedAfter) {
+		return false
+	}
+	if len(f.tags) == 0 {
+		return true
+	}
+
+	itemTags := make(map[string]bool, len(item.Tags))
+	for _, tag := range item.Tags {
+		itemTags[tag] = true
+	}
+	for _, tag := range f.tags {
+		if itemTags[tag] && !f.allTags {
+			return true
+		}
+		if !itemTags[tag] && f.allTags {
+			return false
+		}
+	}
+	return f.allTags
+}
+
+// sortItems orders items by the sort keys, breaking ties by ID so that the
+// order, and so offsets into it, are stable between requests
+func (f listFilters) sortItems(items []*pb.Item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, key := range f.sort {
+			c := sortFields[key.field](items[i], items[j])
+			if key.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return items[i].Id < items[j].Id
+	})
+}
@@ -1,26 +1,104 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
+	"github.com/rinsecrm/api-service/internal/auth"
 	"github.com/rinsecrm/api-service/internal/canaryctx"
 	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/cursor"
+	"github.com/rinsecrm/api-service/internal/idempotency"
+	"github.com/rinsecrm/api-service/internal/jobs"
 	"github.com/rinsecrm/api-service/internal/metrics"
+	"github.com/rinsecrm/api-service/internal/ratelimit"
 	"github.com/rinsecrm/api-service/internal/tracing"
+	pb "github.com/rinsecrm/api-service/proto/go"
 )
 
 type Server struct {
-	storeClient *client.StoreClient
+	storeClient       client.Store
+	verifier          *auth.Verifier
+	idempotencyStore  idempotency.Store
+	idempotencyTTL    time.Duration
+	batchConcurrency  int
+	jobs              *jobs.Manager
+	cursors           *cursor.Codec
+	rateLimiter       ratelimit.Limiter
+	rateLimitPlans    map[string]ratelimit.Limit
+	defaultPlan       string
+	rateLimitByUser   bool
+	rateLimitByRoute  bool
+	maxRequestTimeout time.Duration
 }
 
-func NewServer(storeClient *client.StoreClient) *Server {
+// Config holds the server's collaborators beyond the store client
+type Config struct {
+	Verifier *auth.Verifier
+	// IdempotencyStore enables Idempotency-Key handling when set
+	IdempotencyStore idempotency.Store
+	IdempotencyTTL   time.Duration
+	// BatchConcurrency bounds the store calls in flight for one batch request
+	BatchConcurrency int
+	// Jobs runs asynchronous imports and exports; the job routes need it
+	Jobs *jobs.Manager
+	// CursorSecret signs page tokens. If empty a random secret is used, and
+	// tokens stop working on restart and across replicas.
+	CursorSecret []byte
+	// RateLimiter enforces RateLimitPlans; requests are not limited without it
+	RateLimiter ratelimit.Limiter
+	// RateLimitPlans maps plan names to per-tenant limits
+	RateLimitPlans map[string]ratelimit.Limit
+	// DefaultPlan applies to tokens without a plan in RateLimitPlans
+	DefaultPlan string
+	// RateLimitByUser and RateLimitByRoute give each user, or each route, of
+	// a tenant a bucket of its own
+	RateLimitByUser  bool
+	RateLimitByRoute bool
+	// MaxRequestTimeout caps the budget a client may ask for with
+	// X-Request-Timeout
+	MaxRequestTimeout time.Duration
+}
+
+func NewServer(storeClient client.Store, config Config) *Server {
+	if config.IdempotencyTTL <= 0 {
+		config.IdempotencyTTL = defaultIdempotencyTTL
+	}
+	if len(config.CursorSecret) == 0 {
+		config.CursorSecret = make([]byte, 32)
+		if _, err := rand.Read(config.CursorSecret); err != nil {
+			log.Fatalf("Failed to generate cursor secret: %v", err)
+		}
+		log.Printf("No cursor secret configured; page tokens will not survive a restart")
+	}
+	if config.MaxRequestTimeout <= 0 {
+		config.MaxRequestTimeout = defaultMaxRequestTimeout
+	}
+	if config.BatchConcurrency <= 0 {
+		config.BatchConcurrency = defaultBatchConcurrency
+	}
 	return &Server{
-		storeClient: storeClient,
+		storeClient:       storeClient,
+		verifier:          config.Verifier,
+		idempotencyStore:  config.IdempotencyStore,
+		idempotencyTTL:    config.IdempotencyTTL,
+		batchConcurrency:  config.BatchConcurrency,
+		jobs:              config.Jobs,
+		cursors:           cursor.NewCodec(config.CursorSecret),
+		rateLimiter:       config.RateLimiter,
+		rateLimitPlans:    config.RateLimitPlans,
+		defaultPlan:       config.DefaultPlan,
+		rateLimitByUser:   config.RateLimitByUser,
+		rateLimitByRoute:  config.RateLimitByRoute,
+		maxRequestTimeout: config.MaxRequestTimeout,
 	}
 }
 
@@ -60,22 +138,22 @@ type ItemResponse struct {
 	UpdatedAt      string   `json:"updated_at"`
 	CreatedBy      string   `json:"created_by"`
 	UpdatedBy      string   `json:"updated_by"`
+
+	// fields is the sparse fieldset to render; nil renders every field
+	fields fieldSet
 }
 
 type InventoryUpdateRequest struct {
 	QuantityChange int32  `json:"quantity_change"`
 	Reason         string `json:"reason"`
-	UpdatedBy      string `json:"updated_by"`
 }
 
 type ListResponse struct {
 	Items         []ItemResponse `json:"items"`
 	NextPageToken string         `json:"next_page_token,omitempty"`
-	TotalCount    int32          `json:"total_count"`
-}
-
-type ErrorResponse struct {
-	Error string `json:"error"`
+	// TotalCount is omitted when filters applied by the API make the total
+	// unknown
+	TotalCount *int32 `json:"total_count,omitempty"`
 }
 
 func (s *Server) CreateItem(w http.ResponseWriter, r *http.Request) {
@@ -89,44 +167,27 @@ func (s *Server) CreateItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req ItemRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	fieldErrors, err := decodeJSONBody(w, r, &req)
+	if err != nil {
+		writeDecodeError(w, r, err)
 		return
 	}
-
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	if fieldErrors = req.validate(fieldErrors); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
 		return
 	}
 
-	tenantID := getTenantIDFromRequest(r)
-	userID := getUserFromRequest(r)
-	category := stringToCategory(req.Category)
-
-	item, err := s.storeClient.CreateItem(
-		ctx,
-		tenantID,
-		req.Name,
-		req.Description,
-		req.Price,
-		category,
-		req.SKU,
-		req.InventoryCount,
-		req.Tags,
-		userID,
-	)
+	item, err := s.createItem(ctx, getTenantIDFromRequest(r), getUserFromRequest(r), req)
 	if err != nil {
 		log.Printf("Error creating item: %v", err)
-		writeErrorResponse(w, "Failed to create item", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to create item")
 		return
 	}
 
 	response := protoItemToResponse(item)
 
-	// Record business metrics
-	metrics.RecordItemCreated()
-
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", itemETag(item, nil))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
@@ -140,18 +201,33 @@ func (s *Server) GetItem(w http.ResponseWriter, r *http.Request) {
 		log.Printf("GetItem called with canary PR: %s", canary)
 	}
 
+	fields, fieldErrors := parseFieldSet(r)
+	if len(fieldErrors) > 0 {
+		writeQueryErrors(w, r, fieldErrors)
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 	tenantID := getTenantIDFromRequest(r)
 
+	ctx, staleness := client.AllowStale(ctx)
 	item, err := s.storeClient.GetItem(ctx, tenantID, id)
 	if err != nil {
 		log.Printf("Error getting item: %v", err)
-		writeErrorResponse(w, "Item not found", http.StatusNotFound)
+		writeStoreError(w, r, err, "Failed to get item")
 		return
 	}
+	setStaleHeaders(w, staleness)
 
-	response := protoItemToResponse(item)
+	etag := itemETag(item, fields)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", readCacheControl)
+	if notModified(w, r, etag) {
+		return
+	}
+
+	response := protoItemToResponse(item).selectFields(fields)
 
 	// Record business metrics
 	metrics.RecordItemRetrieved()
@@ -173,47 +249,37 @@ func (s *Server) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	var req ItemUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	fieldErrors, err := decodeJSONBody(w, r, &req)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+	if fieldErrors = req.validate(fieldErrors); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
 		return
 	}
 
-	if req.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	r = r.WithContext(ctx)
+	if !s.ifMatchCurrent(w, r, getTenantIDFromRequest(r), id) {
 		return
 	}
 
-	tenantID := getTenantIDFromRequest(r)
-	userID := getUserFromRequest(r)
-	category := stringToCategory(req.Category)
-	status := stringToStatus(req.Status)
+	s.writeUpdatedItem(w, r, id, req)
+}
 
-	item, err := s.storeClient.UpdateItem(
-		ctx,
-		tenantID,
-		id,
-		req.Name,
-		req.Description,
-		req.Price,
-		category,
-		status,
-		req.SKU,
-		req.InventoryCount,
-		req.Tags,
-		userID,
-	)
+// writeUpdatedItem stores a validated full update and writes the updated item
+func (s *Server) writeUpdatedItem(w http.ResponseWriter, r *http.Request, id string, req ItemUpdateRequest) {
+	item, err := s.updateItem(r.Context(), getTenantIDFromRequest(r), getUserFromRequest(r), id, req)
 	if err != nil {
 		log.Printf("Error updating item: %v", err)
-		writeErrorResponse(w, "Failed to update item", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to update item")
 		return
 	}
 
 	response := protoItemToResponse(item)
 
-	// Record business metrics
-	metrics.RecordItemUpdated()
-
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", itemETag(item, nil))
 	json.NewEncoder(w).Encode(response)
 }
 
@@ -230,21 +296,16 @@ func (s *Server) DeleteItem(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 	tenantID := getTenantIDFromRequest(r)
 
-	success, err := s.storeClient.DeleteItem(ctx, tenantID, id)
-	if err != nil {
-		log.Printf("Error deleting item: %v", err)
-		writeErrorResponse(w, "Failed to delete item", http.StatusInternalServerError)
+	if !s.ifMatchCurrent(w, r.WithContext(ctx), tenantID, id) {
 		return
 	}
 
-	if !success {
-		writeErrorResponse(w, "Item not found", http.StatusNotFound)
+	if err := s.deleteItem(ctx, tenantID, id); err != nil {
+		log.Printf("Error deleting item: %v", err)
+		writeStoreError(w, r, err, "Failed to delete item")
 		return
 	}
 
-	// Record business metrics
-	metrics.RecordItemDeleted()
-
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -255,34 +316,58 @@ func (s *Server) ListItems(w http.ResponseWriter, r *http.Request) {
 
 	tenantID := getTenantIDFromRequest(r)
 
-	pageSize := int32(10) // default
-	if ps := r.URL.Query().Get("page_size"); ps != "" {
-		if parsed, err := strconv.Atoi(ps); err == nil {
-			pageSize = int32(parsed)
+	query, fieldErrors := parseListQuery(r)
+	if len(fieldErrors) > 0 {
+		writeQueryErrors(w, r, fieldErrors)
+		return
+	}
+	filters := query.filters
+
+	var state listCursor
+	if query.pageToken != "" {
+		if err := s.cursors.Decode(query.pageToken, tenantID, filters.scope(), &state); err != nil {
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidCursor,
+				"page_token is invalid or was issued for a different listing")
+			return
 		}
 	}
 
-	pageToken := r.URL.Query().Get("page_token")
-	categoryFilter := stringToCategory(r.URL.Query().Get("category"))
-	statusFilter := stringToStatus(r.URL.Query().Get("status"))
-	searchQuery := r.URL.Query().Get("search")
-
-	items, nextPageToken, totalCount, err := s.storeClient.ListItems(r.Context(), tenantID, categoryFilter, statusFilter, searchQuery, pageSize, pageToken)
+	ctx, staleness := client.AllowStale(r.Context())
+	page, err := s.listItems(ctx, tenantID, filters, query.pageSize, state)
 	if err != nil {
-		log.Printf("Error listing items: %v", err)
-		writeErrorResponse(w, "Failed to list items", http.StatusInternalServerError)
+		writeListError(w, r, err)
+		return
+	}
+	setStaleHeaders(w, staleness)
+
+	var nextCursor string
+	if page.next != nil {
+		if nextCursor, err = s.cursors.Encode(tenantID, filters.scope(), page.next); err != nil {
+			log.Printf("Error encoding page token: %v", err)
+			writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode page token")
+			return
+		}
+	}
+	setPaginationLinks(w, r, nextCursor)
+
+	etag := listETag(page.items, nextCursor, page.total, query.fields)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", readCacheControl)
+	if notModified(w, r, etag) {
 		return
 	}
 
 	var responseItems []ItemResponse
-	for _, item := range items {
-		responseItems = append(responseItems, protoItemToResponse(item))
+	for _, item := range page.items {
+		responseItems = append(responseItems, protoItemToResponse(item).selectFields(query.fields))
 	}
 
 	response := ListResponse{
 		Items:         responseItems,
-		NextPageToken: nextPageToken,
-		TotalCount:    totalCount,
+		NextPageToken: nextCursor,
+	}
+	if page.total >= 0 {
+		response.TotalCount = &page.total
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -298,16 +383,22 @@ func (s *Server) UpdateInventory(w http.ResponseWriter, r *http.Request) {
 	itemID := vars["id"]
 
 	var req InventoryUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	fieldErrors, err := decodeJSONBody(w, r, &req)
+	if err != nil {
+		writeDecodeError(w, r, err)
 		return
 	}
-
-	if req.UpdatedBy == "" {
-		req.UpdatedBy = getUserFromRequest(r)
+	if fieldErrors = req.validate(fieldErrors); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
 	}
 
 	tenantID := getTenantIDFromRequest(r)
+	userID := getUserFromRequest(r)
+
+	if !s.ifMatchCurrent(w, r, tenantID, itemID) {
+		return
+	}
 
 	item, previousCount, err := s.storeClient.UpdateInventory(
 		r.Context(),
@@ -315,11 +406,11 @@ func (s *Server) UpdateInventory(w http.ResponseWriter, r *http.Request) {
 		itemID,
 		req.QuantityChange,
 		req.Reason,
-		req.UpdatedBy,
+		userID,
 	)
 	if err != nil {
 		log.Printf("Error updating inventory: %v", err)
-		writeErrorResponse(w, "Failed to update inventory", http.StatusInternalServerError)
+		writeStoreError(w, r, err, "Failed to update inventory")
 		return
 	}
 
@@ -329,16 +420,74 @@ func (s *Server) UpdateInventory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", itemETag(item, nil))
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+// createItem stores a validated new item
+func (s *Server) createItem(ctx context.Context, tenantID int64, userID string, req ItemRequest) (*pb.Item, error) {
+	item, err := s.storeClient.CreateItem(
+		ctx,
+		tenantID,
+		req.Name,
+		req.Description,
+		req.Price,
+		stringToCategory(req.Category),
+		req.SKU,
+		req.InventoryCount,
+		req.Tags,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record business metrics
+	metrics.RecordItemCreated()
+	return item, nil
 }
 
-func writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+// updateItem stores a validated full update of an item
+func (s *Server) updateItem(ctx context.Context, tenantID int64, userID, id string, req ItemUpdateRequest) (*pb.Item, error) {
+	item, err := s.storeClient.UpdateItem(
+		ctx,
+		tenantID,
+		id,
+		req.Name,
+		req.Description,
+		req.Price,
+		stringToCategory(req.Category),
+		stringToStatus(req.Status),
+		req.SKU,
+		req.InventoryCount,
+		req.Tags,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record business metrics
+	metrics.RecordItemUpdated()
+	return item, nil
+}
+
+// deleteItem deletes an item, reporting an unsuccessful delete as NotFound
+func (s *Server) deleteItem(ctx context.Context, tenantID int64, id string) error {
+	success, err := s.storeClient.DeleteItem(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return status.Error(codes.NotFound, "item not found")
+	}
+
+	// Record business metrics
+	metrics.RecordItemDeleted()
+	return nil
+}
+
+func (s *Server) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
 }
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/idempotency"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLen = 255
+)
+
+// defaultIdempotencyTTL applies when Config.IdempotencyTTL is unset
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// reservationRenewInterval is how often a running request extends its
+// reservation of an idempotency key
+var reservationRenewInterval = idempotency.ReservationTimeout / 3
+
+// replayedHeaders are the representation headers stored with a response and
+// replayed for retries. Others, such as RateLimit-*, describe the request
+// they were sent with and are left to the retry's own middleware.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// recordingResponseWriter passes a response through while keeping a copy
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	if rw.statusCode == 0 {
+		rw.statusCode = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if rw.statusCode == 0 {
+		rw.statusCode = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// shouldStoreResponse reports whether a response is final for its key.
+// Server errors, conflicts and throttling are transient, so the key is
+// released and the client may retry with it.
+func shouldStoreResponse(statusCode int) bool {
+	return statusCode < http.StatusInternalServerError &&
+		statusCode != http.StatusConflict &&
+		statusCode != http.StatusTooManyRequests
+}
+
+// Idempotent makes a handler safe to retry with an Idempotency-Key header:
+// the first response for a tenant's key is stored and replayed for retries,
+// and reusing the key with a different payload is rejected with 422.
+// Requests without the header are passed through unchanged.
+func (s *Server) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || s.idempotencyStore == nil {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidIdempotencyKey,
+				fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen))
+			return
+		}
+
+		// The wrapped handler enforces its own, possibly smaller, limit
+		body, err := readBody(w, r, maxBatchBodyBytes)
+		if err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.New()
+		fmt.Fprintf(fingerprint, "%s\n%s\n", r.Method, r.URL.Path)
+		fingerprint.Write(body)
+		requestFingerprint := hex.EncodeToString(fingerprint.Sum(nil))
+
+		storeKey := fmt.Sprintf("%d:%s", getTenantIDFromRequest(r), key)
+		record, err := s.idempotencyStore.Begin(r.Context(), storeKey, requestFingerprint)
+		if errors.Is(err, idempotency.ErrInProgress) {
+			writeErrorResponse(w, r, http.StatusConflict, CodeIdempotencyKeyInUse,
+				"A request with this Idempotency-Key is still being processed")
+			return
+		}
+		if err != nil {
+			log.Printf("Error reserving idempotency key: %v", err)
+			writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to process Idempotency-Key")
+			return
+		}
+
+		if record != nil {
+			if record.Fingerprint != requestFingerprint {
+				writeErrorResponse(w, r, http.StatusUnprocessableEntity, CodeIdempotencyKeyReused,
+					"This Idempotency-Key was already used with a different request")
+				return
+			}
+			for name, values := range record.Header {
+				w.Header()[name] = append([]string(nil), values...)
+			}
+			w.Header().Set(idempotencyReplayed, "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		// The outcome is recorded even if the request's deadline passed or the
+		// client went away. Unless a response is stored, the key is released,
+		// also if the handler panics, so a retry is not refused with 409.
+		storeCtx := context.WithoutCancel(r.Context())
+		stored := false
+		defer func() {
+			if stored {
+				return
+			}
+			if err := s.idempotencyStore.Release(storeCtx, storeKey); err != nil {
+				log.Printf("Error releasing idempotency key: %v", err)
+			}
+		}()
+
+		// The key lets the store client retry the writes this request makes
+		recorder := &recordingResponseWriter{ResponseWriter: w}
+		stopRenewing := s.renewReservation(storeKey)
+		defer stopRenewing()
+		next(recorder, r.WithContext(client.WithIdempotencyKey(r.Context(), storeKey)))
+		stopRenewing()
+
+		if !shouldStoreResponse(recorder.statusCode) {
+			return
+		}
+		stored = true
+		err = s.idempotencyStore.Complete(storeCtx, storeKey, idempotency.Record{
+			Fingerprint: requestFingerprint,
+			StatusCode:  recorder.statusCode,
+			Header:      representationHeader(w.Header()),
+			Body:        recorder.body.Bytes(),
+			CreatedAt:   time.Now(),
+		}, s.idempotencyTTL)
+		if err != nil {
+			log.Printf("Error storing idempotent response: %v", err)
+		}
+	}
+}
+
+// renewReservation extends the reservation of key until the returned func is
+// first called, so that a long batch or import is not run twice by a retry made
+// after the reservation would have lapsed. Once stop returns, no more
+// extensions are made.
+func (s *Server) renewReservation(key string) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	ticker := time.NewTicker(reservationRenewInterval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.idempotencyStore.Extend(context.Background(), key); err != nil {
+					log.Printf("Error extending idempotency key reservation: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// representationHeader copies the replayedHeaders present in header
+func representationHeader(header http.Header) http.Header {
+	stored := make(http.Header)
+	for _, name := range replayedHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			stored[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return stored
+}
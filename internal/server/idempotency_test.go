@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/idempotency"
+	"github.com/rinsecrm/api-service/internal/ratelimit"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+func TestIdempotentReplayHeaders(t *testing.T) {
+	ts := newTestServerWithStore(t, client.NewMemoryStore(), func(config *Config) {
+		config.RateLimiter = ratelimit.NewMemoryLimiter()
+		config.RateLimitPlans = map[string]ratelimit.Limit{"default": {Rate: 1, Burst: 10}}
+		config.DefaultPlan = "default"
+	})
+
+	send := func() *http.Response {
+		req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+		req.Header.Set("Idempotency-Key", "create-lamp")
+		return ts.serve(req).Result()
+	}
+	first, second := send(), send()
+
+	if second.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatal("retry was not replayed")
+	}
+	for _, name := range replayedHeaders {
+		if got, want := second.Header.Get(name), first.Header.Get(name); got != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+	// The retry reports its own quota, not the original request's
+	if got := second.Header.Get("RateLimit-Remaining"); got != "8" {
+		t.Errorf("replayed RateLimit-Remaining = %q, want 8", got)
+	}
+}
+
+// slowStore makes CreateItem take delay
+type slowStore struct {
+	*client.MemoryStore
+	delay time.Duration
+}
+
+func (s slowStore) CreateItem(ctx context.Context, tenantID int64, name, description string, price float64, category pb.ItemCategory, sku string, inventoryCount int32, tags []string, createdBy string) (*pb.Item, error) {
+	time.Sleep(s.delay)
+	return s.MemoryStore.CreateItem(ctx, tenantID, name, description, price, category, sku, inventoryCount, tags, createdBy)
+}
+
+// countingIdempotencyStore counts reservation renewals
+type countingIdempotencyStore struct {
+	*idempotency.MemoryStore
+	extended atomic.Int32
+}
+
+func (s *countingIdempotencyStore) Extend(ctx context.Context, key string) error {
+	s.extended.Add(1)
+	return s.MemoryStore.Extend(ctx, key)
+}
+
+func TestIdempotentRenewsReservation(t *testing.T) {
+	interval := reservationRenewInterval
+	reservationRenewInterval = 5 * time.Millisecond
+	t.Cleanup(func() { reservationRenewInterval = interval })
+
+	store := &countingIdempotencyStore{MemoryStore: idempotency.NewMemoryStore()}
+	ts := newTestServerWithStore(t, slowStore{MemoryStore: client.NewMemoryStore(), delay: 50 * time.Millisecond}, func(config *Config) {
+		config.IdempotencyStore = store
+	})
+
+	req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+	req.Header.Set("Idempotency-Key", "create-lamp")
+	expectStatus(t, ts.serve(req), http.StatusCreated)
+
+	extended := store.extended.Load()
+	if extended == 0 {
+		t.Fatal("reservation was not renewed while the request ran")
+	}
+	// Renewal stops with the request
+	time.Sleep(20 * time.Millisecond)
+	if store.extended.Load() != extended {
+		t.Fatal("reservation was renewed after the request finished")
+	}
+}
+
+// contextIdempotencyStore fails calls made with a done context, as a
+// networked store would
+type contextIdempotencyStore struct {
+	*idempotency.MemoryStore
+}
+
+func (s contextIdempotencyStore) Complete(ctx context.Context, key string, record idempotency.Record, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Complete(ctx, key, record, ttl)
+}
+
+func (s contextIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Release(ctx, key)
+}
+
+func TestIdempotentReleasesKeyAfterBudgetExpires(t *testing.T) {
+	ts := newTestServerWithStore(t, slowStore{MemoryStore: client.NewMemoryStore(), delay: 50 * time.Millisecond}, func(config *Config) {
+		config.IdempotencyStore = contextIdempotencyStore{idempotency.NewMemoryStore()}
+	})
+	send := func(timeout string) *httptest.ResponseRecorder {
+		req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+		req.Header.Set("Idempotency-Key", "create-lamp")
+		if timeout != "" {
+			req.Header.Set("X-Request-Timeout", timeout)
+		}
+		return ts.serve(req)
+	}
+
+	expectProblem(t, send("10ms"), http.StatusGatewayTimeout, CodeDeadlineExceeded)
+	// The key was released although the request's context had expired
+	expectStatus(t, send(""), http.StatusCreated)
+}
@@ -0,0 +1,525 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/tracing"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// acceptImport advertises the supported import formats
+const acceptImport = csvContentType + ", " + ndjsonContentType
+
+// Import limits
+const (
+	maxImportBodyBytes = 256 << 20
+	maxImportLineBytes = maxRequestBodyBytes
+	importSKUPageSize  = 100
+	// maxImportReportedFailures bounds the failed rows described in a
+	// report; the rest are only counted
+	maxImportReportedFailures = 100
+)
+
+// Import modes
+const (
+	importModeUpsert = "upsert"
+	importModeCreate = "create"
+)
+
+// Import row outcomes
+const (
+	importRowCreated = "created"
+	importRowUpdated = "updated"
+	importRowFailed  = "failed"
+)
+
+// importFields are the ItemRequest members that columns can be mapped onto
+var importFields = []string{"name", "description", "price", "category", "sku", "inventory_count", "tags"}
+
+// columnParamPrefix introduces a column mapping query parameter, for example
+// column.name=Product%20Title
+const columnParamPrefix = "column."
+
+type ImportRowResult struct {
+	Line   int            `json:"line"`
+	Status string         `json:"status"`
+	ID     string         `json:"id,omitempty"`
+	SKU    string         `json:"sku,omitempty"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	Created        int      `json:"created"`
+	Updated        int      `json:"updated"`
+	Failed         int      `json:"failed"`
+	IgnoredColumns []string `json:"ignored_columns,omitempty"`
+	// Failures describes the first maxImportReportedFailures failed rows;
+	// FailuresOmitted counts the others
+	Failures        []ImportRowResult `json:"failures"`
+	FailuresOmitted int               `json:"failures_omitted,omitempty"`
+	// Error is set when the upload could not be read to the end; rows
+	// before it have been applied
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// importOptions are the parsed query parameters of an import
+type importOptions struct {
+	mode string
+	// columns maps a lower-cased source column or key onto an item field
+	columns map[string]string
+}
+
+// parseImportOptions reads the import mode and column mapping. Fields without
+// an explicit mapping are read from the column or key of the same name.
+func parseImportOptions(r *http.Request) (importOptions, []FieldError) {
+	query := r.URL.Query()
+	opts := importOptions{mode: importModeUpsert, columns: make(map[string]string)}
+	v := newValidator(nil)
+
+	if mode := query.Get("mode"); mode != "" {
+		opts.mode = mode
+		v.check(mode == importModeUpsert || mode == importModeCreate, "mode", "must be one of %s, %s", importModeUpsert, importModeCreate)
+	}
+
+	mapped := make(map[string]bool)
+	for param, values := range query {
+		field, ok := strings.CutPrefix(param, columnParamPrefix)
+		if !ok {
+			continue
+		}
+		known := false
+		for _, importField := range importFields {
+			known = known || importField == field
+		}
+		source := strings.ToLower(strings.TrimSpace(values[0]))
+		v.check(known, param, "must name one of %s", strings.Join(importFields, ", "))
+		v.check(source != "", param, "must not be empty")
+		if other, taken := opts.columns[source]; taken {
+			v.check(false, param, "maps the same column as %s%s", columnParamPrefix, other)
+		}
+		if known && source != "" {
+			opts.columns[source] = field
+			mapped[field] = true
+		}
+	}
+	for _, field := range importFields {
+		if _, taken := opts.columns[field]; !mapped[field] && !taken {
+			opts.columns[field] = field
+		}
+	}
+	return opts, v.errors
+}
+
+// importRow is one record of an upload, converted to item JSON members
+type importRow struct {
+	line   int
+	fields map[string]json.RawMessage
+	// malformed is set when the record itself could not be parsed
+	malformed error
+}
+
+// importSource yields the rows of an upload one at a time, returning io.EOF
+// after the last row
+type importSource interface {
+	next() (importRow, error)
+}
+
+// csvImportSource reads a CSV upload whose first record is a header row
+type csvImportSource struct {
+	reader *csv.Reader
+	// fields holds the item field for each column, or "" if it is ignored
+	fields []string
+}
+
+func newCSVImportSource(body io.Reader, opts importOptions) (*csvImportSource, []string, error) {
+	reader := csv.NewReader(body)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("CSV upload must start with a header row")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source := &csvImportSource{reader: reader, fields: make([]string, len(header))}
+	var ignored []string
+	hasName := false
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		field, ok := opts.columns[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			ignored = append(ignored, column)
+			continue
+		}
+		source.fields[i] = field
+		hasName = hasName || field == "name"
+	}
+	if !hasName && opts.mode == importModeCreate {
+		return nil, nil, errors.New("CSV header has no column for name")
+	}
+	return source, ignored, nil
+}
+
+func (s *csvImportSource) next() (importRow, error) {
+	record, err := s.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{line: parseErr.StartLine, malformed: parseErr.Err}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := s.reader.FieldPos(0)
+	row := importRow{line: line, fields: make(map[string]json.RawMessage)}
+	for i, cell := range record {
+		cell = unescapeFormula(strings.TrimSpace(cell))
+		if s.fields[i] == "" || cell == "" {
+			continue
+		}
+		row.fields[s.fields[i]] = csvCellJSON(s.fields[i], cell)
+	}
+	return row, nil
+}
+
+// quotedPrefixes are the characters after which a leading quote marks the
+// rest of a CSV cell as text: a formula character, or a second quote, which
+// writes a literal leading quote
+const quotedPrefixes = "=+-@'"
+
+// unescapeFormula removes the quote that spreadsheets, and this service's
+// exports, put before text that would otherwise be a formula, so '=A1
+// imports as =A1 and a doubled quote leaves a single one. Any other leading
+// quote is kept.
+func unescapeFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(quotedPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// csvCellJSON converts a cell to the JSON member for field. Cells that are
+// not valid for the field are passed on as strings so that the type error is
+// reported the same way as for JSON bodies.
+func csvCellJSON(field, cell string) json.RawMessage {
+	switch field {
+	case "price", "inventory_count":
+		if _, err := strconv.ParseFloat(cell, 64); err == nil && json.Valid([]byte(cell)) {
+			return json.RawMessage(cell)
+		}
+	case "tags":
+		tags := []string{}
+		for _, tag := range strings.Split(cell, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		raw, _ := json.Marshal(tags)
+		return raw
+	}
+	raw, _ := json.Marshal(cell)
+	return raw
+}
+
+// ndjsonImportSource reads an upload with one JSON object per line
+type ndjsonImportSource struct {
+	scanner *bufio.Scanner
+	line    int
+	columns map[string]string
+}
+
+func newNDJSONImportSource(body io.Reader, opts importOptions) *ndjsonImportSource {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLineBytes)
+	return &ndjsonImportSource{scanner: scanner, columns: opts.columns}
+}
+
+func (s *ndjsonImportSource) next() (importRow, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &object); err != nil || object == nil {
+			return importRow{line: s.line, malformed: errors.New("line is not a JSON object")}, nil
+		}
+		row := importRow{line: s.line, fields: make(map[string]json.RawMessage, len(object))}
+		for key, value := range object {
+			// Unmapped keys are kept so they are reported as unknown fields
+			if field, ok := s.columns[strings.ToLower(key)]; ok {
+				key = field
+			}
+			row.fields[key] = value
+		}
+		return row, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return importRow{}, fmt.Errorf("line %d exceeds %d bytes", s.line+1, maxImportLineBytes)
+		}
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
+
+// importItems applies every row of source in order, reporting each outcome.
+// Rows are applied one at a time so that repeated SKUs in one upload update
+// the item created by their first occurrence. Row problems name instance,
+// the path the upload was sent to.
+func (s *Server) importItems(ctx context.Context, instance string, tenantID int64, userID, mode string, source importSource, report func(ImportRowResult)) error {
+	skus := &skuIndex{}
+	for {
+		row, err := source.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		report(s.importRow(ctx, instance, tenantID, userID, mode, row, skus))
+	}
+}
+
+// importRow validates and applies a single row
+func (s *Server) importRow(ctx context.Context, instance string, tenantID int64, userID, mode string, row importRow, skus *skuIndex) ImportRowResult {
+	result := ImportRowResult{Line: row.line, Status: importRowFailed}
+	fail := func(problem ErrorResponse) ImportRowResult {
+		result.Error = &problem
+		return result
+	}
+
+	if row.malformed != nil {
+		return fail(newProblemAt(ctx, instance, http.StatusBadRequest, CodeMalformedRow, row.malformed.Error()))
+	}
+
+	var req ItemRequest
+	fieldErrors := assignJSONFields(row.fields, &req)
+	result.SKU = req.SKU
+
+	var existing *pb.Item
+	if mode == importModeUpsert && req.SKU != "" && len(fieldErrors) == 0 {
+		var err error
+		if existing, err = s.findItemBySKU(ctx, tenantID, skus, req.SKU); err != nil {
+			log.Printf("Error looking up SKU for import: %v", err)
+			problem, _ := storeErrorProblemAt(ctx, instance, err, "Failed to look up item by SKU")
+			return fail(problem)
+		}
+	}
+
+	if existing == nil {
+		if fieldErrors = req.validate(fieldErrors); len(fieldErrors) > 0 {
+			problem := newProblemAt(ctx, instance, http.StatusUnprocessableEntity, CodeValidationFailed, "Row validation failed")
+			problem.Errors = fieldErrors
+			return fail(problem)
+		}
+		item, err := s.createItem(ctx, tenantID, userID, req)
+		if err != nil {
+			log.Printf("Error creating item from import: %v", err)
+			problem, _ := storeErrorProblemAt(ctx, instance, err, "Failed to create item")
+			return fail(problem)
+		}
+		skus.add(req.SKU, item.Id)
+		result.Status, result.ID = importRowCreated, item.Id
+		return result
+	}
+
+	// Columns missing from the row keep the existing item's values
+	update := itemToUpdateRequest(existing)
+	fieldErrors = assignJSONFields(row.fields, &update)
+	if fieldErrors = update.validate(fieldErrors); len(fieldErrors) > 0 {
+		problem := newProblemAt(ctx, instance, http.StatusUnprocessableEntity, CodeValidationFailed, "Row validation failed")
+		problem.Errors = fieldErrors
+		return fail(problem)
+	}
+	item, err := s.updateItem(ctx, tenantID, userID, existing.Id, update)
+	if err != nil {
+		log.Printf("Error updating item from import: %v", err)
+		problem, _ := storeErrorProblemAt(ctx, instance, err, "Failed to update item")
+		return fail(problem)
+	}
+	skus.add(item.Sku, item.Id)
+	result.Status, result.ID = importRowUpdated, item.Id
+	return result
+}
+
+// skuIndex maps the SKUs of a tenant's items to their IDs for an upsert. It
+// is loaded with a single pass over the tenant's items when the first row
+// needs it, and then kept up to date with the items the upload writes.
+type skuIndex struct {
+	ids map[string]string
+}
+
+func (index *skuIndex) add(sku, id string) {
+	if index.ids != nil && sku != "" {
+		index.ids[sku] = id
+	}
+}
+
+// findItemBySKU returns the tenant's item with sku, or nil if there is none
+func (s *Server) findItemBySKU(ctx context.Context, tenantID int64, index *skuIndex, sku string) (*pb.Item, error) {
+	ctx = client.BypassCache(ctx)
+	if index.ids == nil {
+		ids := make(map[string]string)
+		pageToken := ""
+		for {
+			items, nextPageToken, _, err := s.storeClient.ListItems(ctx, tenantID,
+				pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED, pb.ItemStatus_ITEM_STATUS_UNSPECIFIED,
+				"", importSKUPageSize, pageToken)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if _, seen := ids[item.Sku]; item.Sku != "" && !seen {
+					ids[item.Sku] = item.Id
+				}
+			}
+			if nextPageToken == "" {
+				break
+			}
+			pageToken = nextPageToken
+		}
+		index.ids = ids
+	}
+
+	id, ok := index.ids[sku]
+	if !ok {
+		return nil, nil
+	}
+	item, err := s.storeClient.GetItem(ctx, tenantID, id)
+	if status.Code(err) == codes.NotFound {
+		delete(index.ids, sku)
+		return nil, nil
+	}
+	return item, err
+}
+
+// ImportItems creates or upserts items from a CSV or NDJSON upload, streaming
+// the body row by row, and reports the counts of each outcome and the rows
+// that failed
+func (s *Server) ImportItems(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.import_items")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("ImportItems called with canary PR: %s", canary)
+	}
+
+	mediaType, ok := importMediaType(w, r)
+	if !ok {
+		return
+	}
+
+	opts, fieldErrors := parseImportOptions(r)
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBodyBytes)
+	source, ignored, err := newImportSource(mediaType, body, opts)
+	if err != nil {
+		writeImportReadError(w, r, err)
+		return
+	}
+
+	response := ImportResponse{Failures: []ImportRowResult{}, IgnoredColumns: ignored}
+	err = s.importItems(ctx, r.URL.Path, getTenantIDFromRequest(r), getUserFromRequest(r), opts.mode, source, response.add)
+	if err != nil {
+		log.Printf("Import stopped early: %v", err)
+		problem := importReadProblem(r, err)
+		response.Error = &problem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// importMediaType returns the media type of an upload, writing 415 if it is
+// not a supported import format
+func importMediaType(w http.ResponseWriter, r *http.Request) (string, bool) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != csvContentType && mediaType != ndjsonContentType {
+		w.Header().Set("Accept-Post", acceptImport)
+		writeErrorResponse(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"Content-Type must be "+csvContentType+" or "+ndjsonContentType)
+		return "", false
+	}
+	return mediaType, true
+}
+
+// newImportSource starts reading an upload of the given media type,
+// returning the CSV columns that are not mapped onto an item field
+func newImportSource(mediaType string, body io.Reader, opts importOptions) (importSource, []string, error) {
+	if mediaType == csvContentType {
+		source, ignored, err := newCSVImportSource(body, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return source, ignored, nil
+	}
+	return newNDJSONImportSource(body, opts), nil, nil
+}
+
+// add records the outcome of a row
+func (response *ImportResponse) add(result ImportRowResult) {
+	switch result.Status {
+	case importRowCreated:
+		response.Created++
+	case importRowUpdated:
+		response.Updated++
+	default:
+		response.Failed++
+		if len(response.Failures) < maxImportReportedFailures {
+			response.Failures = append(response.Failures, result)
+		} else {
+			response.FailuresOmitted++
+		}
+	}
+}
+
+// importReadProblem describes a failure to read the upload itself
+func importReadProblem(r *http.Request, err error) ErrorResponse {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return newProblem(r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("Upload exceeds %d bytes", maxBytesErr.Limit))
+	}
+	return newProblem(r, http.StatusBadRequest, CodeMalformedRow, "Upload could not be read: "+err.Error())
+}
+
+// writeImportReadError reports an upload that failed before any row was applied
+func writeImportReadError(w http.ResponseWriter, r *http.Request, err error) {
+	writeProblem(w, importReadProblem(r, err))
+}
@@ -0,0 +1,556 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rinsecrm/api-service/internal/client"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+func TestCreateItem(t *testing.T) {
+	ts := newTestServer(t)
+
+	item := ts.createItem(`{"name":"Lamp","price":19.99,"category":"home","sku":"LAMP-1","inventory_count":3,"tags":["light"]}`)
+	if item.ID == "" || item.TenantID != testTenant || item.Name != "Lamp" || item.Status != "active" || item.CreatedBy != "user-1" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+
+	rec := ts.do(http.MethodPost, "/api/v1/items", "application/json", `{"name":"","price":-1,"category":"home"}`)
+	expectProblem(t, rec, http.StatusUnprocessableEntity, CodeValidationFailed)
+	if problem := decodeResponse[ErrorResponse](t, rec); len(problem.Errors) != 2 {
+		t.Fatalf("got %d field errors, want 2: %+v", len(problem.Errors), problem.Errors)
+	}
+
+	expectProblem(t, ts.do(http.MethodPost, "/api/v1/items", "application/json", `{`), http.StatusBadRequest, CodeInvalidJSON)
+	expectProblem(t, ts.do(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home","colour":"red"}`), http.StatusUnprocessableEntity, CodeValidationFailed)
+}
+
+func TestCreateItemFieldNamesIgnoreCase(t *testing.T) {
+	ts := newTestServer(t)
+
+	item := ts.createItem(`{"Name":"Lamp","PRICE":10,"Category":"home","name":"Desk Lamp"}`)
+	if item.Name != "Desk Lamp" || item.Price != 10 || item.Category != "home" {
+		t.Fatalf("unexpected item %+v", item)
+	}
+}
+
+// httpResult is the part of a response compared across retries
+type httpResult struct {
+	code     int
+	replayed string
+	body     string
+}
+
+func TestCreateItemIdempotencyKey(t *testing.T) {
+	ts := newTestServer(t)
+	body := `{"name":"Lamp","price":10,"category":"home"}`
+
+	send := func(body string) *httpResult {
+		req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", body)
+		req.Header.Set("Idempotency-Key", "create-lamp")
+		rec := ts.serve(req)
+		return &httpResult{code: rec.Code, replayed: rec.Header().Get("Idempotent-Replayed"), body: rec.Body.String()}
+	}
+
+	first, second := send(body), send(body)
+	if first.code != http.StatusCreated || second.code != http.StatusCreated {
+		t.Fatalf("statuses = %d, %d, want 201", first.code, second.code)
+	}
+	if second.replayed != "true" || second.body != first.body {
+		t.Fatal("retry was not replayed")
+	}
+	if reused := send(`{"name":"Desk","price":10,"category":"home"}`); reused.code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key status = %d, want 422", reused.code)
+	}
+
+	rec := ts.do(http.MethodGet, "/api/v1/items", "", "")
+	if list := decodeResponse[ListResponse](t, rec); len(list.Items) != 1 {
+		t.Fatalf("listed %d items, want 1", len(list.Items))
+	}
+}
+
+func TestGetItem(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	rec := ts.do(http.MethodGet, "/api/v1/items/"+item.ID, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if got := decodeResponse[ItemResponse](t, rec); got.ID != item.ID || got.Name != "Lamp" {
+		t.Fatalf("unexpected item %+v", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	req := ts.newRequest(http.MethodGet, "/api/v1/items/"+item.ID, "", "")
+	req.Header.Set("If-None-Match", etag)
+	expectStatus(t, ts.serve(req), http.StatusNotModified)
+
+	rec = ts.do(http.MethodGet, "/api/v1/items/"+item.ID+"?fields=id,name", "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if fields := decodeResponse[map[string]interface{}](t, rec); len(fields) != 2 || fields["name"] != "Lamp" {
+		t.Fatalf("fields=id,name returned %v", fields)
+	}
+
+	// A sparse fieldset is a representation of its own, so the full item's
+	// tag does not revalidate it
+	fieldsETag := rec.Header().Get("ETag")
+	if fieldsETag == "" || fieldsETag == etag {
+		t.Fatalf("fields=id,name ETag %q, full item ETag %q", fieldsETag, etag)
+	}
+	req = ts.newRequest(http.MethodGet, "/api/v1/items/"+item.ID+"?fields=id,name", "", "")
+	req.Header.Set("If-None-Match", etag)
+	expectStatus(t, ts.serve(req), http.StatusOK)
+	req = ts.newRequest(http.MethodGet, "/api/v1/items/"+item.ID+"?fields=name,id", "", "")
+	req.Header.Set("If-None-Match", fieldsETag)
+	expectStatus(t, ts.serve(req), http.StatusNotModified)
+
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items/missing", "", ""), http.StatusNotFound, CodeNotFound)
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items/"+item.ID+"?fields=bogus", "", ""), http.StatusBadRequest, CodeInvalidQuery)
+}
+
+func TestListItems(t *testing.T) {
+	ts := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		ts.createItem(fmt.Sprintf(`{"name":"Book %d","price":%d,"category":"books"}`, i, 10+i))
+	}
+	ts.createItem(`{"name":"Shirt","price":25,"category":"clothing","tags":["cotton"]}`)
+
+	// Page through every item
+	seen := make(map[string]bool)
+	target := "/api/v1/items?page_size=2"
+	for pages := 0; target != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("listing did not end")
+		}
+		rec := ts.do(http.MethodGet, target, "", "")
+		expectStatus(t, rec, http.StatusOK)
+		list := decodeResponse[ListResponse](t, rec)
+		if list.TotalCount == nil || *list.TotalCount != 6 {
+			t.Fatalf("total_count = %v, want 6", list.TotalCount)
+		}
+		for _, item := range list.Items {
+			if seen[item.ID] {
+				t.Fatalf("item %s listed twice", item.ID)
+			}
+			seen[item.ID] = true
+		}
+		target = ""
+		if list.NextPageToken != "" {
+			target = "/api/v1/items?page_size=2&page_token=" + list.NextPageToken
+		}
+	}
+	if len(seen) != 6 {
+		t.Fatalf("listed %d items, want 6", len(seen))
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"category=books", 5},
+		{"category=books,clothing", 6},
+		{"search=shirt", 1},
+		{"min_price=12&max_price=14", 3},
+		{"tags=cotton", 1},
+	}
+	for _, tt := range tests {
+		rec := ts.do(http.MethodGet, "/api/v1/items?"+tt.query, "", "")
+		expectStatus(t, rec, http.StatusOK)
+		if list := decodeResponse[ListResponse](t, rec); len(list.Items) != tt.want {
+			t.Errorf("%s listed %d items, want %d", tt.query, len(list.Items), tt.want)
+		}
+	}
+
+	rec := ts.do(http.MethodGet, "/api/v1/items?sort=-price&page_size=1", "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if list := decodeResponse[ListResponse](t, rec); len(list.Items) != 1 || list.Items[0].Name != "Shirt" {
+		t.Fatalf("sort=-price returned %+v", list.Items)
+	}
+
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items?page_size=0", "", ""), http.StatusBadRequest, CodeInvalidQuery)
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items?page_token=forged", "", ""), http.StatusBadRequest, CodeInvalidCursor)
+}
+
+// reversedStore returns each store page in descending ID order
+type reversedStore struct {
+	*client.MemoryStore
+}
+
+func (s reversedStore) ListItems(ctx context.Context, tenantID int64, category pb.ItemCategory, itemStatus pb.ItemStatus, searchQuery string, pageSize int32, pageToken string) ([]*pb.Item, string, int32, error) {
+	items, next, total, err := s.MemoryStore.ListItems(ctx, tenantID, category, itemStatus, searchQuery, pageSize, pageToken)
+	slices.Reverse(items)
+	return items, next, total, err
+}
+
+func TestListItemsMergesUnorderedShards(t *testing.T) {
+	ts := newTestServerWithStore(t, reversedStore{client.NewMemoryStore()})
+	for i := 0; i < 4; i++ {
+		ts.createItem(fmt.Sprintf(`{"name":"Book %d","price":10,"category":"books"}`, i))
+		ts.createItem(fmt.Sprintf(`{"name":"Shirt %d","price":10,"category":"clothing"}`, i))
+	}
+
+	var ids []string
+	target := "/api/v1/items?category=books,clothing&page_size=3"
+	for target != "" {
+		rec := ts.do(http.MethodGet, target, "", "")
+		expectStatus(t, rec, http.StatusOK)
+		list := decodeResponse[ListResponse](t, rec)
+		for _, item := range list.Items {
+			ids = append(ids, item.ID)
+		}
+		target = ""
+		if list.NextPageToken != "" {
+			target = "/api/v1/items?category=books,clothing&page_size=3&page_token=" + list.NextPageToken
+		}
+	}
+	if len(ids) != 8 || !slices.IsSorted(ids) || len(slices.Compact(slices.Clone(ids))) != 8 {
+		t.Fatalf("listed %v, want 8 distinct items in ID order", ids)
+	}
+}
+
+func TestListItemsSortLimitIsTotal(t *testing.T) {
+	store := client.NewMemoryStore()
+	ts := newTestServerWithStore(t, store)
+	// Each shard is under the limit, but together they are over it
+	for i := 0; i <= maxSortedItems; i++ {
+		category := pb.ItemCategory_ITEM_CATEGORY_BOOKS
+		if i%2 == 1 {
+			category = pb.ItemCategory_ITEM_CATEGORY_CLOTHING
+		}
+		if _, err := store.CreateItem(context.Background(), testTenant, fmt.Sprintf("Item %d", i), "", 10, category, "", 0, nil, "user-1"); err != nil {
+			t.Fatalf("CreateItem: %v", err)
+		}
+	}
+
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items?category=books,clothing&sort=name", "", ""), http.StatusBadRequest, CodeInvalidQuery)
+	expectStatus(t, ts.do(http.MethodGet, "/api/v1/items?category=books&sort=name", "", ""), http.StatusOK)
+}
+
+func TestUpdateItem(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+	target := "/api/v1/items/" + item.ID
+
+	rec := ts.do(http.MethodPut, target, "application/json", `{"name":"Desk Lamp","price":12,"category":"home","status":"inactive"}`)
+	expectStatus(t, rec, http.StatusOK)
+	updated := decodeResponse[ItemResponse](t, rec)
+	if updated.Name != "Desk Lamp" || updated.Status != "inactive" || updated.UpdatedBy != "user-1" {
+		t.Fatalf("unexpected item %+v", updated)
+	}
+
+	req := ts.newRequest(http.MethodPut, target, "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+	req.Header.Set("If-Match", `"stale"`)
+	expectProblem(t, ts.serve(req), http.StatusPreconditionFailed, CodeETagMismatch)
+
+	req = ts.newRequest(http.MethodPut, target, "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+	req.Header.Set("If-Match", rec.Header().Get("ETag"))
+	expectStatus(t, ts.serve(req), http.StatusOK)
+
+	expectProblem(t, ts.do(http.MethodPut, "/api/v1/items/missing", "application/json", `{"name":"Lamp","price":10,"category":"home"}`), http.StatusNotFound, CodeNotFound)
+}
+
+func TestPatchItem(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home","tags":["light"]}`)
+	target := "/api/v1/items/" + item.ID
+
+	rec := ts.do(http.MethodPatch, target, mergePatchContentType, `{"price":15,"tags":null}`)
+	expectStatus(t, rec, http.StatusOK)
+	if patched := decodeResponse[ItemResponse](t, rec); patched.Price != 15 || patched.Name != "Lamp" || len(patched.Tags) != 0 {
+		t.Fatalf("merge patch gave %+v", patched)
+	}
+
+	rec = ts.do(http.MethodPatch, target, jsonPatchContentType, `[{"op":"test","path":"/price","value":15},{"op":"replace","path":"/name","value":"Desk Lamp"}]`)
+	expectStatus(t, rec, http.StatusOK)
+	if patched := decodeResponse[ItemResponse](t, rec); patched.Name != "Desk Lamp" {
+		t.Fatalf("JSON patch gave %+v", patched)
+	}
+
+	expectProblem(t, ts.do(http.MethodPatch, target, jsonPatchContentType, `[{"op":"test","path":"/price","value":1}]`), http.StatusConflict, CodePatchTestFailed)
+	expectProblem(t, ts.do(http.MethodPatch, target, "application/json", `{}`), http.StatusUnsupportedMediaType, CodeUnsupportedMediaType)
+}
+
+func TestDeleteItem(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+	target := "/api/v1/items/" + item.ID
+
+	expectStatus(t, ts.do(http.MethodDelete, target, "", ""), http.StatusNoContent)
+	expectProblem(t, ts.do(http.MethodGet, target, "", ""), http.StatusNotFound, CodeNotFound)
+	expectProblem(t, ts.do(http.MethodDelete, target, "", ""), http.StatusNotFound, CodeNotFound)
+}
+
+func TestUpdateInventory(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home","inventory_count":5}`)
+	target := "/api/v1/items/" + item.ID + "/inventory"
+
+	rec := ts.do(http.MethodPatch, target, "application/json", `{"quantity_change":-2,"reason":"sold"}`)
+	expectStatus(t, rec, http.StatusOK)
+	response := decodeResponse[struct {
+		Item          ItemResponse `json:"item"`
+		PreviousCount int32        `json:"previous_count"`
+	}](t, rec)
+	if response.PreviousCount != 5 || response.Item.InventoryCount != 3 {
+		t.Fatalf("previous_count %d, inventory_count %d, want 5 and 3", response.PreviousCount, response.Item.InventoryCount)
+	}
+
+	expectProblem(t, ts.do(http.MethodPatch, target, "application/json", `{"quantity_change":-4}`), http.StatusPreconditionFailed, CodePreconditionFail)
+	expectProblem(t, ts.do(http.MethodPatch, "/api/v1/items/missing/inventory", "application/json", `{"quantity_change":1}`), http.StatusNotFound, CodeNotFound)
+
+	req := ts.newRequest(http.MethodPatch, target, "application/json", `{"quantity_change":1}`)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant, "inventory-clerk"))
+	expectStatus(t, ts.serve(req), http.StatusOK)
+}
+
+func TestBatchItems(t *testing.T) {
+	ts := newTestServer(t)
+	existing := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	body := fmt.Sprintf(`{"operations":[
+		{"op":"create","item":{"name":"Desk","price":100,"category":"home"}},
+		{"op":"update","id":%q,"item":{"name":"Lamp","price":11,"category":"home","status":"active"}},
+		{"op":"delete","id":"missing"}
+	]}`, existing.ID)
+	rec := ts.do(http.MethodPost, "/api/v1/items:batch", "application/json", body)
+	expectStatus(t, rec, http.StatusMultiStatus)
+	response := decodeResponse[BatchResponse](t, rec)
+	if response.Succeeded != 2 || response.Failed != 1 {
+		t.Fatalf("succeeded %d, failed %d, want 2 and 1", response.Succeeded, response.Failed)
+	}
+	statuses := []int{http.StatusCreated, http.StatusOK, http.StatusNotFound}
+	for i, result := range response.Results {
+		if result.Status != statuses[i] {
+			t.Errorf("operation %d status = %d, want %d", i, result.Status, statuses[i])
+		}
+	}
+
+	// An atomic batch with a failing operation leaves nothing behind
+	body = `{"atomic":true,"operations":[
+		{"op":"create","item":{"name":"Chair","price":50,"category":"home"}},
+		{"op":"delete","id":"missing"}
+	]}`
+	rec = ts.do(http.MethodPost, "/api/v1/items:batch", "application/json", body)
+	expectStatus(t, rec, http.StatusMultiStatus)
+	if response := decodeResponse[BatchResponse](t, rec); response.Committed == nil || *response.Committed {
+		t.Fatalf("atomic batch committed = %v, want false", response.Committed)
+	}
+	rec = ts.do(http.MethodGet, "/api/v1/items?search=chair", "", "")
+	if list := decodeResponse[ListResponse](t, rec); len(list.Items) != 0 {
+		t.Fatal("rolled back item is still listed")
+	}
+}
+
+// failingDeleteStore fails every delete, including the ones that roll back
+// an atomic batch
+type failingDeleteStore struct {
+	*client.MemoryStore
+}
+
+func (s failingDeleteStore) DeleteItem(ctx context.Context, tenantID int64, id string) (bool, error) {
+	return false, errors.New("store unavailable")
+}
+
+func TestBatchItemsRollbackFailed(t *testing.T) {
+	ts := newTestServerWithStore(t, failingDeleteStore{client.NewMemoryStore()})
+	existing := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	// The delete fails, and so does deleting the created item to roll back
+	body := fmt.Sprintf(`{"atomic":true,"operations":[
+		{"op":"create","item":{"name":"Chair","price":50,"category":"home"}},
+		{"op":"delete","id":%q}
+	]}`, existing.ID)
+	rec := ts.do(http.MethodPost, "/api/v1/items:batch", "application/json", body)
+	expectStatus(t, rec, http.StatusMultiStatus)
+	response := decodeResponse[BatchResponse](t, rec)
+	problem := response.Results[0].Error
+	if problem == nil || response.Results[0].RolledBack {
+		t.Fatalf("create result %+v, want a failed rollback", response.Results[0])
+	}
+	if problem.Code != CodeRollbackFailed || problem.Type != problemTypePrefix+CodeRollbackFailed {
+		t.Fatalf("rollback problem type %q, code %q", problem.Type, problem.Code)
+	}
+}
+
+func TestImportItems(t *testing.T) {
+	ts := newTestServer(t)
+
+	upload := "name,price,category,sku\nLamp,10,home,LAMP-1\nDesk,abc,home,DESK-1\n"
+	rec := ts.do(http.MethodPost, "/api/v1/items/import", csvContentType, upload)
+	expectStatus(t, rec, http.StatusOK)
+	response := decodeResponse[ImportResponse](t, rec)
+	if response.Created != 1 || response.Failed != 1 {
+		t.Fatalf("created %d, failed %d, want 1 and 1", response.Created, response.Failed)
+	}
+	if len(response.Failures) != 1 || response.Failures[0].Line != 3 {
+		t.Fatalf("unexpected failures %+v", response.Failures)
+	}
+
+	// Upserts match rows to items by SKU
+	upload = `{"name":"Lamp","price":12,"category":"home","sku":"LAMP-1"}` + "\n"
+	rec = ts.do(http.MethodPost, "/api/v1/items/import", ndjsonContentType, upload)
+	expectStatus(t, rec, http.StatusOK)
+	if response := decodeResponse[ImportResponse](t, rec); response.Updated != 1 {
+		t.Fatalf("updated %d, want 1", response.Updated)
+	}
+
+	expectProblem(t, ts.do(http.MethodPost, "/api/v1/items/import", "application/json", `{}`), http.StatusUnsupportedMediaType, CodeUnsupportedMediaType)
+}
+
+func TestExportItems(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+	ts.createItem(`{"name":"Novel","price":8,"category":"books"}`)
+
+	rec := ts.do(http.MethodGet, "/api/v1/items/export?format=csv&category=home&fields=name,price", "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("Content-Disposition = %q", rec.Header().Get("Content-Disposition"))
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != 2 || len(records[0]) != 2 || records[1][0] != "Lamp" {
+		t.Fatalf("unexpected export %v", records)
+	}
+
+	rec = ts.do(http.MethodGet, "/api/v1/items/export?format=ndjson", "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 2 {
+		t.Fatalf("NDJSON export has %d lines, want 2", lines)
+	}
+
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items/export?format=pdf", "", ""), http.StatusUnprocessableEntity, CodeValidationFailed)
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/items/export?sort=price", "", ""), http.StatusBadRequest, CodeInvalidQuery)
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	ts := newTestServer(t)
+	items := []ItemResponse{
+		ts.createItem(`{"name":"=SUM(A1:A9)","description":"-2+3","price":10,"category":"home","sku":"LAMP-1"}`),
+		ts.createItem(`{"name":"'-5% promo","description":"'hello","price":10,"category":"home","sku":"DESK-1"}`),
+	}
+
+	rec := ts.do(http.MethodGet, "/api/v1/items/export?format=csv&fields=name,description,price,sku", "", "")
+	expectStatus(t, rec, http.StatusOK)
+	export := rec.Body.String()
+	records, err := csv.NewReader(strings.NewReader(export)).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	want := map[string][]string{
+		"LAMP-1": {"'=SUM(A1:A9)", "'-2+3", "10", "LAMP-1"},
+		"DESK-1": {"''-5% promo", "'hello", "10", "DESK-1"},
+	}
+	if len(records) != 3 {
+		t.Fatalf("unexpected export %v", records)
+	}
+	for _, record := range records[1:] {
+		if !slices.Equal(record, want[record[3]]) {
+			t.Fatalf("exported %v, want %v", record, want[record[3]])
+		}
+	}
+
+	// Re-importing the export leaves the items unchanged
+	rec = ts.do(http.MethodPost, "/api/v1/items/import", csvContentType, export)
+	expectStatus(t, rec, http.StatusOK)
+	if response := decodeResponse[ImportResponse](t, rec); response.Updated != 2 {
+		t.Fatalf("import updated %d items, want 2: %+v", response.Updated, response.Failures)
+	}
+	for _, item := range items {
+		rec = ts.do(http.MethodGet, "/api/v1/items/"+item.ID, "", "")
+		if got := decodeResponse[ItemResponse](t, rec); got.Name != item.Name || got.Description != item.Description {
+			t.Fatalf("re-imported item %q, %q, want %q, %q", got.Name, got.Description, item.Name, item.Description)
+		}
+	}
+}
+
+func TestImportQuotedCells(t *testing.T) {
+	ts := newTestServer(t)
+
+	// A leading quote is only removed before a formula character or a
+	// second quote, as spreadsheets write text that would be a formula
+	upload := "name,description,price,category\n'=A1,''-5% promo,10,home\n'hello,'-5% promo,10,home\n"
+	rec := ts.do(http.MethodPost, "/api/v1/items/import?mode=create", csvContentType, upload)
+	expectStatus(t, rec, http.StatusOK)
+	if response := decodeResponse[ImportResponse](t, rec); response.Created != 2 {
+		t.Fatalf("import created %d items, want 2: %+v", response.Created, response.Failures)
+	}
+
+	rec = ts.do(http.MethodGet, "/api/v1/items?sort=name", "", "")
+	list := decodeResponse[ListResponse](t, rec)
+	if len(list.Items) != 2 {
+		t.Fatalf("listed %d items, want 2", len(list.Items))
+	}
+	got := [][2]string{{list.Items[0].Name, list.Items[0].Description}, {list.Items[1].Name, list.Items[1].Description}}
+	want := [][2]string{{"'hello", "-5% promo"}, {"=A1", "'-5% promo"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("imported %v, want %v", got, want)
+	}
+}
+
+// listCountingStore counts ListItems calls
+type listCountingStore struct {
+	*client.MemoryStore
+	lists atomic.Int32
+}
+
+func (s *listCountingStore) ListItems(ctx context.Context, tenantID int64, category pb.ItemCategory, itemStatus pb.ItemStatus, searchQuery string, pageSize int32, pageToken string) ([]*pb.Item, string, int32, error) {
+	s.lists.Add(1)
+	return s.MemoryStore.ListItems(ctx, tenantID, category, itemStatus, searchQuery, pageSize, pageToken)
+}
+
+func TestImportItemsUpsertBySKU(t *testing.T) {
+	store := &listCountingStore{MemoryStore: client.NewMemoryStore()}
+	ts := newTestServerWithStore(t, store)
+	lamp := ts.createItem(`{"name":"Lamp","price":10,"category":"home","sku":"LAMP-1"}`)
+	ts.createItem(`{"name":"Desk","price":100,"category":"home","sku":"DESK-1"}`)
+
+	upload := "name,price,category,sku\nLamp,12,home,LAMP-1\nChair,50,home,CHAIR-1\nChair,55,home,CHAIR-1\nShelf,30,home,SHELF-1\n"
+	rec := ts.do(http.MethodPost, "/api/v1/items/import", csvContentType, upload)
+	expectStatus(t, rec, http.StatusOK)
+	response := decodeResponse[ImportResponse](t, rec)
+	if response.Created != 2 || response.Updated != 2 || response.Failed != 0 {
+		t.Fatalf("created %d, updated %d, failed %d, want 2, 2 and 0", response.Created, response.Updated, response.Failed)
+	}
+	// SKUs are resolved from one pass over the tenant's items, not per row
+	if lists := store.lists.Load(); lists != 1 {
+		t.Fatalf("import listed items %d times, want 1", lists)
+	}
+
+	rec = ts.do(http.MethodGet, "/api/v1/items/"+lamp.ID, "", "")
+	if item := decodeResponse[ItemResponse](t, rec); item.Price != 12 {
+		t.Fatalf("price = %v, want 12", item.Price)
+	}
+	rec = ts.do(http.MethodGet, "/api/v1/items?search=chair", "", "")
+	if list := decodeResponse[ListResponse](t, rec); len(list.Items) != 1 || list.Items[0].Price != 55 {
+		t.Fatalf("chairs %+v, want one priced 55", list.Items)
+	}
+}
+
+func TestImportItemsBoundsFailures(t *testing.T) {
+	ts := newTestServer(t)
+
+	var upload strings.Builder
+	upload.WriteString("name,price,category\n")
+	for i := 0; i < maxImportReportedFailures+5; i++ {
+		upload.WriteString("Lamp,-1,home\n")
+	}
+	rec := ts.do(http.MethodPost, "/api/v1/items/import", csvContentType, upload.String())
+	expectStatus(t, rec, http.StatusOK)
+	response := decodeResponse[ImportResponse](t, rec)
+	if response.Failed != maxImportReportedFailures+5 || len(response.Failures) != maxImportReportedFailures || response.FailuresOmitted != 5 {
+		t.Fatalf("failed %d, reported %d, omitted %d", response.Failed, len(response.Failures), response.FailuresOmitted)
+	}
+}
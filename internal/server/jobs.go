@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rinsecrm/api-service/internal/auth"
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/jobs"
+	"github.com/rinsecrm/api-service/internal/metrics"
+	"github.com/rinsecrm/api-service/internal/tracing"
+)
+
+// Job types
+const (
+	jobTypeImport = "import"
+	jobTypeExport = "export"
+)
+
+// jobPermissions is the permission needed to submit, and so to cancel, each
+// type of job
+var jobPermissions = map[string]auth.Permission{
+	jobTypeImport: auth.PermissionItemsWrite,
+	jobTypeExport: auth.PermissionItemsRead,
+}
+
+// jobQueueRetryAfter is suggested to clients when the job queue is full
+const jobQueueRetryAfter = 30 * time.Second
+
+type JobError struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+type JobResponse struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Status     string     `json:"status"`
+	Message    string     `json:"message,omitempty"`
+	Total      int        `json:"total,omitempty"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	Errors     []JobError `json:"errors,omitempty"`
+	ResultURL  string     `json:"result_url,omitempty"`
+	CreatedAt  string     `json:"created_at"`
+	StartedAt  string     `json:"started_at,omitempty"`
+	FinishedAt string     `json:"finished_at,omitempty"`
+}
+
+func jobToResponse(job jobs.Job) JobResponse {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	response := JobResponse{
+		ID:         job.ID,
+		Type:       job.Type,
+		Status:     string(job.Status),
+		Message:    job.Message,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		Succeeded:  job.Succeeded,
+		Failed:     job.Failed,
+		CreatedAt:  formatTime(job.CreatedAt),
+		StartedAt:  formatTime(job.StartedAt),
+		FinishedAt: formatTime(job.FinishedAt),
+	}
+	for _, jobErr := range job.Errors {
+		response.Errors = append(response.Errors, JobError{Line: jobErr.Line, Message: jobErr.Message})
+	}
+	if job.Status == jobs.StatusSucceeded && job.ResultPath != "" {
+		response.ResultURL = "/api/v1/jobs/" + job.ID + "/result"
+	}
+	return response
+}
+
+// problemSummary flattens a row's problem into a single job error message
+func problemSummary(problem *ErrorResponse) string {
+	var fieldErrors []string
+	for _, fieldError := range problem.Errors {
+		fieldErrors = append(fieldErrors, fieldError.Field+" "+fieldError.Message)
+	}
+	if len(fieldErrors) == 0 {
+		return problem.Detail
+	}
+	return problem.Detail + ": " + strings.Join(fieldErrors, "; ")
+}
+
+// submitJob queues a job for the caller's tenant and answers 202 Accepted
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, job jobs.Job, run jobs.RunFunc) {
+	job.TenantID = getTenantIDFromRequest(r)
+	job.CreatedBy = getUserFromRequest(r)
+
+	job, err := s.jobs.Submit(r.Context(), job, run)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", int(jobQueueRetryAfter.Seconds())))
+		writeErrorResponse(w, r, http.StatusServiceUnavailable, CodeJobQueueFull, "Too many jobs are waiting; retry later")
+		return
+	}
+	if err != nil {
+		log.Printf("Error submitting %s job: %v", job.Type, err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to submit job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(jobToResponse(job))
+}
+
+// SubmitImportJob accepts the same upload as ImportItems and imports it in
+// the background
+func (s *Server) SubmitImportJob(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.submit_import_job")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("SubmitImportJob called with canary PR: %s", canary)
+	}
+
+	mediaType, ok := importMediaType(w, r)
+	if !ok {
+		return
+	}
+	opts, fieldErrors := parseImportOptions(r)
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	// The upload is spooled to disk so the job outlives the request
+	upload, err := s.jobs.CreateInput()
+	if err != nil {
+		log.Printf("Error creating import spool file: %v", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to store upload")
+		return
+	}
+	_, err = io.Copy(upload, http.MaxBytesReader(w, r.Body, maxImportBodyBytes))
+	if closeErr := upload.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(upload.Name())
+		writeImportReadError(w, r, err)
+		return
+	}
+
+	// The job keeps only these values; the request is gone by the time it runs
+	instance := r.URL.Path
+	tenantID := getTenantIDFromRequest(r)
+	userID := getUserFromRequest(r)
+	path := upload.Name()
+	job := jobs.Job{Type: jobTypeImport, InputPath: path}
+	s.submitJob(w, r.WithContext(ctx), job, func(ctx context.Context, progress *jobs.Progress) error {
+		return s.runImportJob(ctx, instance, tenantID, userID, mediaType, opts, path, progress)
+	})
+}
+
+// runImportJob imports the spooled upload at path. Its report holds counts and
+// the first maxImportReportedFailures failed rows, like an ImportItems
+// response.
+func (s *Server) runImportJob(ctx context.Context, instance string, tenantID int64, userID, mediaType string, opts importOptions, path string, progress *jobs.Progress) error {
+	upload, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer upload.Close()
+
+	source, ignored, err := newImportSource(mediaType, upload, opts)
+	if err != nil {
+		return err
+	}
+
+	report := ImportResponse{Failures: []ImportRowResult{}, IgnoredColumns: ignored}
+	err = s.importItems(ctx, instance, tenantID, userID, opts.mode, source, func(result ImportRowResult) {
+		report.add(result)
+		if result.Error != nil {
+			progress.Failed(result.Line, problemSummary(result.Error))
+		} else {
+			progress.Succeeded(1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := progress.CreateResult("application/json", "import-"+progress.ID()+".json")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(result).Encode(report); err != nil {
+		result.Close()
+		return err
+	}
+	return result.Close()
+}
+
+// SubmitExportJob accepts the same parameters as ExportItems and writes the
+// export to a file that can be downloaded once the job succeeds
+func (s *Server) SubmitExportJob(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.submit_export_job")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("SubmitExportJob called with canary PR: %s", canary)
+	}
+
+	format, fieldErrors := exportFormatFromRequest(r)
+	if len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	filters, fields, fieldErrors := parseExportQuery(r, format)
+	if len(fieldErrors) > 0 {
+		writeQueryErrors(w, r, fieldErrors)
+		return
+	}
+
+	tenantID := getTenantIDFromRequest(r)
+	s.submitJob(w, r.WithContext(ctx), jobs.Job{Type: jobTypeExport}, func(ctx context.Context, progress *jobs.Progress) error {
+		return s.runExportJob(ctx, tenantID, format, filters, fields, progress)
+	})
+}
+
+func (s *Server) runExportJob(ctx context.Context, tenantID int64, format string, filters listFilters, fields fieldSet, progress *jobs.Progress) error {
+	page, err := s.listItems(ctx, tenantID, filters, exportPageSize, listCursor{})
+	if err != nil {
+		return err
+	}
+	if page.total >= 0 {
+		progress.SetTotal(int(page.total))
+	}
+
+	contentType, _ := exportContentType(format)
+	result, err := progress.CreateResult(contentType, exportFilename(tenantID, format))
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+
+	encoder, err := newItemEncoder(format, result, fields)
+	if err != nil {
+		return err
+	}
+	err = s.writeExport(ctx, tenantID, filters, encoder, page, func(count int) error {
+		progress.Succeeded(count)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+	return result.Close()
+}
+
+// tenantJob loads the job named in the path, writing 404 if it does not
+// exist or belongs to another tenant
+func (s *Server) tenantJob(w http.ResponseWriter, r *http.Request) (jobs.Job, bool) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	job, err := s.jobs.Get(r.Context(), id)
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && job.TenantID != getTenantIDFromRequest(r)) {
+		writeErrorResponse(w, r, http.StatusNotFound, CodeNotFound, "Job not found")
+		return jobs.Job{}, false
+	}
+	if err != nil {
+		log.Printf("Error getting job: %v", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to get job")
+		return jobs.Job{}, false
+	}
+	return job, true
+}
+
+// GetJob reports the status and progress of a job
+func (s *Server) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.tenantJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobToResponse(job))
+}
+
+// CancelJob cancels a queued or running job. Cancelling requires the
+// permission the job was submitted with.
+func (s *Server) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.tenantJob(w, r)
+	if !ok {
+		return
+	}
+
+	permission := jobPermissions[job.Type]
+	identity, _ := auth.FromContext(r.Context())
+	if !identity.HasPermission(permission) {
+		metrics.RecordAuthorizationDenied(r.Method, "/api/v1/jobs/{id}", string(permission))
+		writeErrorResponse(w, r, http.StatusForbidden, CodeForbidden, fmt.Sprintf("Permission %q is required", permission))
+		return
+	}
+	if job.Status.Finished() {
+		writeErrorResponse(w, r, http.StatusConflict, CodeJobFinished, "The job has already finished")
+		return
+	}
+
+	job, err := s.jobs.Cancel(r.Context(), job.ID)
+	if err != nil {
+		log.Printf("Error canceling job: %v", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to cancel job")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(jobToResponse(job))
+}
+
+// GetJobResult downloads the output of a succeeded job
+func (s *Server) GetJobResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.tenantJob(w, r)
+	if !ok {
+		return
+	}
+	if job.Status != jobs.StatusSucceeded || job.ResultPath == "" {
+		writeErrorResponse(w, r, http.StatusConflict, CodeJobResultUnavailable,
+			fmt.Sprintf("The job is %s and has no result", job.Status))
+		return
+	}
+
+	result, err := os.Open(job.ResultPath)
+	if err != nil {
+		log.Printf("Error opening job result: %v", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to read job result")
+		return
+	}
+	defer result.Close()
+
+	w.Header().Set("Content-Type", job.ResultContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", job.ResultFilename))
+	http.ServeContent(w, r, job.ResultFilename, job.FinishedAt, result)
+}
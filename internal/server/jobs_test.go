@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/auth"
+)
+
+// waitForJob polls a job until it finishes
+func (ts *testServer) waitForJob(location string) JobResponse {
+	ts.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := ts.do(http.MethodGet, location, "", "")
+		expectStatus(ts.t, rec, http.StatusOK)
+		job := decodeResponse[JobResponse](ts.t, rec)
+		switch job.Status {
+		case "succeeded", "failed", "canceled":
+			return job
+		}
+		if time.Now().After(deadline) {
+			ts.t.Fatalf("job still %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestImportJob(t *testing.T) {
+	ts := newTestServer(t)
+
+	upload := "name,price,category\nLamp,10,home\nDesk,-5,home\n"
+	rec := ts.do(http.MethodPost, "/api/v1/jobs/imports", csvContentType, upload)
+	expectStatus(t, rec, http.StatusAccepted)
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/jobs/") {
+		t.Fatalf("Location = %q", location)
+	}
+
+	job := ts.waitForJob(location)
+	if job.Status != "succeeded" || job.Succeeded != 1 || job.Failed != 1 || len(job.Errors) != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	expectProblem(t, ts.do(http.MethodDelete, location, "", ""), http.StatusConflict, CodeJobFinished)
+}
+
+func TestExportJob(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+	ts.createItem(`{"name":"Desk","price":100,"category":"home"}`)
+
+	rec := ts.do(http.MethodPost, "/api/v1/jobs/exports?format=ndjson", "", "")
+	expectStatus(t, rec, http.StatusAccepted)
+	job := ts.waitForJob(rec.Header().Get("Location"))
+	if job.Status != "succeeded" || job.ResultURL == "" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	rec = ts.do(http.MethodGet, job.ResultURL, "", "")
+	expectStatus(t, rec, http.StatusOK)
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 2 {
+		t.Fatalf("export has %d lines, want 2", lines)
+	}
+}
+
+func TestJobAccess(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do(http.MethodPost, "/api/v1/jobs/exports?format=csv", "", "")
+	expectStatus(t, rec, http.StatusAccepted)
+	location := rec.Header().Get("Location")
+	ts.waitForJob(location)
+
+	// Jobs of other tenants are hidden
+	req := ts.newRequest(http.MethodGet, location, "", "")
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant+1, auth.RoleAdmin))
+	expectProblem(t, ts.serve(req), http.StatusNotFound, CodeNotFound)
+
+	// Viewers may export but not import
+	req = ts.newRequest(http.MethodPost, "/api/v1/jobs/imports", csvContentType, "name,price,category\n")
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant, auth.RoleViewer))
+	expectProblem(t, ts.serve(req), http.StatusForbidden, CodeForbidden)
+
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/jobs/missing", "", ""), http.StatusNotFound, CodeNotFound)
+	expectProblem(t, ts.do(http.MethodGet, "/api/v1/jobs/missing/result", "", ""), http.StatusNotFound, CodeNotFound)
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// errPatchTestFailed is returned when a JSON Patch "test" operation does not match
+var errPatchTestFailed = errors.New("test operation failed")
+
+// patchOperation is a single RFC 6902 JSON Patch operation
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// value decodes the operation's value member, which may legitimately be null
+func (op patchOperation) value() (interface{}, error) {
+	if len(op.Value) == 0 {
+		return nil, errors.New("missing value")
+	}
+	var value interface{}
+	if err := json.Unmarshal(op.Value, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// applyMergePatch applies an RFC 7396 JSON Merge Patch to target. Both are
+// generic values as produced by encoding/json.
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = applyMergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// applyJSONPatch applies RFC 6902 JSON Patch operations to doc in order
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	var err error
+	for i, op := range operations {
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		return addAtPointer(doc, path, value)
+	case "remove":
+		doc, _, err := removeAtPointer(doc, path)
+		return doc, err
+	case "replace":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = removeAtPointer(doc, path); err != nil {
+			return nil, err
+		}
+		return addAtPointer(doc, path, value)
+	case "move":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if isPointerPrefix(from, path) && len(from) < len(path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, value, err := removeAtPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addAtPointer(doc, path, value)
+	case "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getAtPointer(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return addAtPointer(doc, path, deepCopyJSON(value))
+	case "test":
+		expected, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := getAtPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(value, expected) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if index > limit {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+func getAtPointer(doc interface{}, path []string) (interface{}, error) {
+	current := doc
+	for _, token := range path {
+		switch container := current.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(container), false)
+			if err != nil {
+				return nil, err
+			}
+			current = container[index]
+		default:
+			return nil, fmt.Errorf("cannot traverse into %q", token)
+		}
+	}
+	return current, nil
+}
+
+// addAtPointer returns doc with value added at path, per the RFC 6902 "add" rules
+func addAtPointer(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := getAtPointer(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(container), true)
+		if err != nil {
+			return nil, err
+		}
+		grown := append(container[:index:index], append([]interface{}{value}, container[index:]...)...)
+		return replaceAtPointer(doc, path[:len(path)-1], grown)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", strings.Join(path[:len(path)-1], "/"))
+	}
+}
+
+// removeAtPointer returns doc without the value at path, and the removed value
+func removeAtPointer(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := getAtPointer(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		value, ok := container[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(container, last)
+		return doc, value, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := container[index]
+		shrunk := append(container[:index:index], container[index+1:]...)
+		doc, err = replaceAtPointer(doc, path[:len(path)-1], shrunk)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from %q", strings.Join(path[:len(path)-1], "/"))
+	}
+}
+
+// replaceAtPointer swaps the value at an existing path, used to store resized arrays
+func replaceAtPointer(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := getAtPointer(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		container[last] = value
+	case []interface{}:
+		index, err := arrayIndex(last, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = value
+	}
+	return doc, nil
+}
+
+func deepCopyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for name, member := range v {
+			copied[name] = deepCopyJSON(member)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = deepCopyJSON(element)
+		}
+		return copied
+	default:
+		return v
+	}
+}
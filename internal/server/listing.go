@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+// scanPageSize is the store page size used when the API filters, merges or
+// sorts items itself
+const scanPageSize = maxPageSize
+
+// maxScanPages bounds the store pages read to fill one page of a listing. A
+// page may come back short, with a next_page_token to carry on from.
+const maxScanPages = 50
+
+// maxSortedItems bounds the listings that can be sorted, since sorting reads
+// the whole listing into memory
+const maxSortedItems = 10000
+
+// errTooManyToSort is returned when a sorted listing exceeds maxSortedItems
+var errTooManyToSort = errors.New("too many items to sort")
+
+// errScanLimit stops a page once it has read maxScanPages store pages
+var errScanLimit = errors.New("scan limit reached")
+
+// listCursor is the pagination state signed into a ListItems page_token
+type listCursor struct {
+	// StoreToken continues a listing read straight from the store
+	StoreToken string `json:"st,omitempty"`
+	// Shards hold the position in each shard of a scanned listing
+	Shards []shardCursor `json:"sh,omitempty"`
+	// Offset is the position in a sorted listing
+	Offset int `json:"o,omitempty"`
+}
+
+// shardCursor is the position in one shard of a scanned listing
+type shardCursor struct {
+	StoreToken string `json:"st,omitempty"`
+	// Skip is how many items of the store page at StoreToken were consumed
+	Skip int  `json:"sk,omitempty"`
+	Done bool `json:"d,omitempty"`
+}
+
+// itemPage is one page of a listing
+type itemPage struct {
+	items []*pb.Item
+	// next continues the listing; nil on the last page
+	next *listCursor
+	// total is the size of the listing, or -1 when it is not known
+	total int32
+}
+
+// listItems reads the page of the listing that starts at cursor. A listing
+// the store can answer in one query is paged by the store. Otherwise the API
+// scans store pages, one query per shard, which costs more store calls.
+func (s *Server) listItems(ctx context.Context, tenantID int64, filters listFilters, pageSize int32, cursor listCursor) (itemPage, error) {
+	shards := filters.shards()
+	if len(filters.sort) > 0 {
+		return s.listSortedItems(ctx, tenantID, filters, shards, pageSize, cursor)
+	}
+	if len(shards) > 1 || filters.filtersItems() {
+		return s.scanItems(ctx, tenantID, filters, shards, pageSize, cursor)
+	}
+
+	items, nextPageToken, totalCount, err := s.storeClient.ListItems(ctx, tenantID, shards[0].category, shards[0].status, filters.search, pageSize, cursor.StoreToken)
+	if err != nil {
+		return itemPage{}, err
+	}
+	page := itemPage{items: items, total: totalCount}
+	if nextPageToken != "" {
+		page.next = &listCursor{StoreToken: nextPageToken}
+	}
+	return page, nil
+}
+
+// shardScan reads the matching items of one shard in store order
+type shardScan struct {
+	shard listShard
+	// position is where items, once loaded, begin to be unconsumed
+	position shardCursor
+	loaded   bool
+	items    []*pb.Item
+	// nextPageToken follows the loaded store page
+	nextPageToken string
+	totalCount    int32
+}
+
+// load reads the store page at the scan's position, sorted by ID. The store
+// does not promise an order, so the page is sorted before it is merged and
+// Skip counts items in that order.
+func (scan *shardScan) load(ctx context.Context, s *Server, tenantID int64, filters listFilters) error {
+	items, nextPageToken, totalCount, err := s.storeClient.ListItems(ctx, tenantID, scan.shard.category, scan.shard.status, filters.search, scanPageSize, scan.position.StoreToken)
+	if err != nil {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Id < items[j].Id })
+	scan.loaded = true
+	scan.items, scan.nextPageToken, scan.totalCount = items, nextPageToken, totalCount
+	return nil
+}
+
+// peek returns the shard's next matching item, or nil once the shard is
+// exhausted. budget counts down the store pages the page may still read.
+func (scan *shardScan) peek(ctx context.Context, s *Server, tenantID int64, filters listFilters, budget *int) (*pb.Item, error) {
+	for !scan.position.Done {
+		if !scan.loaded {
+			if *budget == 0 {
+				return nil, errScanLimit
+			}
+			*budget--
+			if err := scan.load(ctx, s, tenantID, filters); err != nil {
+				return nil, err
+			}
+		}
+
+		for ; scan.position.Skip < len(scan.items); scan.position.Skip++ {
+			if item := scan.items[scan.position.Skip]; filters.matches(item) {
+				return item, nil
+			}
+		}
+		if scan.nextPageToken == "" {
+			scan.position.Done = true
+		} else {
+			scan.position = shardCursor{StoreToken: scan.nextPageToken}
+			scan.loaded = false
+		}
+	}
+	return nil, nil
+}
+
+// scanItems fills a page by merging the matching items of every shard. The
+// first store page of each shard is read in parallel; items are then taken
+// by ID across the shards' sorted pages, so the order is the same on every
+// request.
+func (s *Server) scanItems(ctx context.Context, tenantID int64, filters listFilters, shards []listShard, pageSize int32, cursor listCursor) (itemPage, error) {
+	scans := make([]*shardScan, len(shards))
+	for i, shard := range shards {
+		scans[i] = &shardScan{shard: shard}
+		if len(cursor.Shards) == len(shards) {
+			scans[i].position = cursor.Shards[i]
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		budget   = maxScanPages
+		allRead  = true
+	)
+	for _, scan := range scans {
+		if scan.position.Done {
+			allRead = false
+			continue
+		}
+		budget--
+		wg.Add(1)
+		go func(scan *shardScan) {
+			defer wg.Done()
+			if err := scan.load(ctx, s, tenantID, filters); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(scan)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return itemPage{}, firstErr
+	}
+
+	page := itemPage{items: []*pb.Item{}, total: -1}
+	// Without filters of its own the API can add up the store's totals,
+	// provided every shard was queried
+	if allRead && !filters.filtersItems() {
+		page.total = 0
+		for _, scan := range scans {
+			page.total += scan.totalCount
+		}
+	}
+
+	for {
+		var next *shardScan
+		var nextItem *pb.Item
+		for _, scan := range scans {
+			item, err := scan.peek(ctx, s, tenantID, filters, &budget)
+			if errors.Is(err, errScanLimit) {
+				page.next = scanCursor(scans)
+				return page, nil
+			}
+			if err != nil {
+				return itemPage{}, err
+			}
+			if item != nil && (nextItem == nil || item.Id < nextItem.Id) {
+				next, nextItem = scan, item
+			}
+		}
+		if next == nil {
+			return page, nil
+		}
+		// The page is only closed once another item is found, so the last
+		// page never carries a next_page_token
+		if len(page.items) == int(pageSize) {
+			page.next = scanCursor(scans)
+			return page, nil
+		}
+		page.items = append(page.items, nextItem)
+		next.position.Skip++
+	}
+}
+
+func scanCursor(scans []*shardScan) *listCursor {
+	cursor := &listCursor{Shards: make([]shardCursor, len(scans))}
+	for i, scan := range scans {
+		cursor.Shards[i] = scan.position
+	}
+	return cursor
+}
+
+// listSortedItems reads every matching item of every shard, in parallel,
+// sorts them and returns the page at the cursor's offset
+func (s *Server) listSortedItems(ctx context.Context, tenantID int64, filters listFilters, shards []listShard, pageSize int32, cursor listCursor) (itemPage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		matched  []*pb.Item
+		read     atomic.Int32
+	)
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard listShard) {
+			defer wg.Done()
+			items, err := s.readShard(ctx, tenantID, filters, shard, &read)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && firstErr == nil {
+				// The other shards' items are of no use without these
+				firstErr = err
+				cancel()
+			}
+			matched = append(matched, items...)
+		}(shard)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return itemPage{}, firstErr
+	}
+	filters.sortItems(matched)
+
+	page := itemPage{items: []*pb.Item{}, total: int32(len(matched))}
+	if cursor.Offset >= len(matched) {
+		return page, nil
+	}
+	end := cursor.Offset + int(pageSize)
+	if end < len(matched) {
+		page.next = &listCursor{Offset: end}
+	} else {
+		end = len(matched)
+	}
+	page.items = matched[cursor.Offset:end]
+	return page, nil
+}
+
+// readShard reads every matching item of a shard. read counts the items
+// matched across all shards, so the read gives up once the listing as a whole
+// has more than can be sorted.
+func (s *Server) readShard(ctx context.Context, tenantID int64, filters listFilters, shard listShard, read *atomic.Int32) ([]*pb.Item, error) {
+	var matched []*pb.Item
+	storeToken := ""
+	for {
+		items, nextPageToken, _, err := s.storeClient.ListItems(ctx, tenantID, shard.category, shard.status, filters.search, scanPageSize, storeToken)
+		if err != nil {
+			return nil, err
+		}
+		pageMatched := 0
+		for _, item := range items {
+			if filters.matches(item) {
+				matched = append(matched, item)
+				pageMatched++
+			}
+		}
+		if read.Add(int32(pageMatched)) > maxSortedItems {
+			return nil, errTooManyToSort
+		}
+		if nextPageToken == "" {
+			return matched, nil
+		}
+		storeToken = nextPageToken
+	}
+}
@@ -2,13 +2,33 @@ package server
 
 import (
 	"net/http"
-	"strconv"
 
+	"github.com/rinsecrm/api-service/internal/auth"
 	pb "github.com/rinsecrm/api-service/proto/go"
 )
 
 // Helper functions for converting between HTTP request/response and proto types
 
+// categoryNames and statusNames list the values accepted by the API
+var (
+	categoryNames = []string{"electronics", "clothing", "books", "home", "sports"}
+	statusNames   = []string{"active", "inactive", "out_of_stock", "discontinued"}
+)
+
+// parseCategory is like stringToCategory but reports whether the value is
+// known; an empty string is accepted as unspecified
+func parseCategory(category string) (pb.ItemCategory, bool) {
+	parsed := stringToCategory(category)
+	return parsed, category == "" || parsed != pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED
+}
+
+// parseStatus is like stringToStatus but reports whether the value is known;
+// an empty string is accepted as unspecified
+func parseStatus(status string) (pb.ItemStatus, bool) {
+	parsed := stringToStatus(status)
+	return parsed, status == "" || parsed != pb.ItemStatus_ITEM_STATUS_UNSPECIFIED
+}
+
 func stringToCategory(category string) pb.ItemCategory {
 	switch category {
 	case "electronics":
@@ -99,27 +119,49 @@ func protoItemToResponse(item *pb.Item) ItemResponse {
 	}
 }
 
-// getTenantIDFromRequest extracts tenant ID from request context or headers
-// In a real implementation, this would be extracted from JWT token or similar auth mechanism
-func getTenantIDFromRequest(r *http.Request) int64 {
-	// For demo purposes, use a header. In production, extract from authenticated context
-	if tenantHeader := r.Header.Get("X-Tenant-ID"); tenantHeader != "" {
-		// Parse tenant ID from header
-		if tenantID, err := strconv.ParseInt(tenantHeader, 10, 64); err == nil {
-			return tenantID
-		}
+// itemToCreateRequest rebuilds the request that would recreate item
+func itemToCreateRequest(item *pb.Item) ItemRequest {
+	req := ItemRequest{
+		Name:           item.Name,
+		Description:    item.Description,
+		Price:          item.Price,
+		SKU:            item.Sku,
+		InventoryCount: item.InventoryCount,
+		Tags:           item.Tags,
+	}
+	if item.Category != pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED {
+		req.Category = categoryToString(item.Category)
 	}
-	// Default tenant for demo
-	return 1
+	return req
 }
 
-// getUserFromRequest extracts user ID from request context or headers
-// In a real implementation, this would be extracted from JWT token or similar auth mechanism
-func getUserFromRequest(r *http.Request) string {
-	// For demo purposes, use a header. In production, extract from authenticated context
-	if userHeader := r.Header.Get("X-User-ID"); userHeader != "" {
-		return userHeader
+// itemToUpdateRequest rebuilds the full update that would restore item
+func itemToUpdateRequest(item *pb.Item) ItemUpdateRequest {
+	create := itemToCreateRequest(item)
+	req := ItemUpdateRequest{
+		Name:           create.Name,
+		Description:    create.Description,
+		Price:          create.Price,
+		Category:       create.Category,
+		SKU:            create.SKU,
+		InventoryCount: create.InventoryCount,
+		Tags:           create.Tags,
 	}
-	// Default user for demo
-	return "system"
+	if item.Status != pb.ItemStatus_ITEM_STATUS_UNSPECIFIED {
+		req.Status = statusToString(item.Status)
+	}
+	return req
+}
+
+// getTenantIDFromRequest returns the tenant of the authenticated caller.
+// Routes are wrapped by Authenticate, so the identity is always present.
+func getTenantIDFromRequest(r *http.Request) int64 {
+	identity, _ := auth.FromContext(r.Context())
+	return identity.TenantID
+}
+
+// getUserFromRequest returns the subject of the authenticated caller
+func getUserFromRequest(r *http.Request) string {
+	identity, _ := auth.FromContext(r.Context())
+	return identity.Subject
 }
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/rinsecrm/api-service/internal/auth"
+)
+
+// Authenticate rejects requests without a valid bearer token and stores the
+// caller's identity in the request context
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.TokenFromRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api-service"`)
+			writeErrorResponse(w, r, http.StatusUnauthorized, CodeUnauthenticated, "Authentication required")
+			return
+		}
+
+		identity, err := s.verifier.Verify(r.Context(), token)
+		if err != nil {
+			log.Printf("Rejected token: %v", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api-service", error="invalid_token"`)
+			writeErrorResponse(w, r, http.StatusUnauthorized, CodeUnauthenticated, "Invalid or expired token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/tracing"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// acceptPatch advertises the supported patch formats (RFC 5789)
+const acceptPatch = mergePatchContentType + ", " + jsonPatchContentType
+
+// itemPatchDocument renders the mutable fields of an item as the document
+// that patches are applied to. Unlike ItemUpdateRequest, zero values are kept
+// so JSON Patch paths always resolve, and unspecified enums are rendered as
+// "" so they round-trip through validation.
+func itemPatchDocument(item *pb.Item) (interface{}, error) {
+	tags := item.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	category, status := "", ""
+	if item.Category != pb.ItemCategory_ITEM_CATEGORY_UNSPECIFIED {
+		category = categoryToString(item.Category)
+	}
+	if item.Status != pb.ItemStatus_ITEM_STATUS_UNSPECIFIED {
+		status = statusToString(item.Status)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"name":            item.Name,
+		"description":     item.Description,
+		"price":           item.Price,
+		"category":        category,
+		"status":          status,
+		"sku":             item.Sku,
+		"inventory_count": item.InventoryCount,
+		"tags":            tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+// PatchItem applies an RFC 7396 JSON Merge Patch or RFC 6902 JSON Patch to an item
+func (s *Server) PatchItem(w http.ResponseWriter, r *http.Request) {
+	// Start custom span for business logic
+	ctx, span := tracing.StartSpan(r.Context(), "api.patch_item")
+	defer span.End()
+
+	if canary, ok := canaryctx.FromContext(r.Context()); ok {
+		log.Printf("PatchItem called with canary PR: %s", canary)
+	}
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchContentType && mediaType != jsonPatchContentType {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		writeErrorResponse(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"Content-Type must be "+mergePatchContentType+" or "+jsonPatchContentType)
+		return
+	}
+
+	body, err := readBody(w, r, maxRequestBodyBytes)
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return
+	}
+
+	tenantID := getTenantIDFromRequest(r)
+
+	current, err := s.storeClient.GetItem(client.BypassCache(ctx), tenantID, id)
+	if err != nil {
+		log.Printf("Error getting item for patch: %v", err)
+		writeStoreError(w, r, err, "Failed to get item")
+		return
+	}
+	if !checkIfMatch(w, r, current) {
+		return
+	}
+
+	doc, err := itemPatchDocument(current)
+	if err != nil {
+		log.Printf("Error rendering item for patch: %v", err)
+		writeErrorResponse(w, r, http.StatusInternalServerError, CodeInternal, "Failed to prepare item for patching")
+		return
+	}
+
+	if mediaType == mergePatchContentType {
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		doc = applyMergePatch(doc, patch)
+	} else {
+		var operations []patchOperation
+		if err := json.Unmarshal(body, &operations); err != nil {
+			writeDecodeError(w, r, err)
+			return
+		}
+		if doc, err = applyJSONPatch(doc, operations); err != nil {
+			if errors.Is(err, errPatchTestFailed) {
+				writeErrorResponse(w, r, http.StatusConflict, CodePatchTestFailed, err.Error())
+				return
+			}
+			writeErrorResponse(w, r, http.StatusUnprocessableEntity, CodePatchFailed, err.Error())
+			return
+		}
+	}
+
+	fields, ok := doc.(map[string]interface{})
+	if !ok {
+		writeErrorResponse(w, r, http.StatusUnprocessableEntity, CodePatchFailed, "Patched document must be a JSON object")
+		return
+	}
+	raw := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		if raw[name], err = json.Marshal(value); err != nil {
+			writeErrorResponse(w, r, http.StatusUnprocessableEntity, CodePatchFailed, err.Error())
+			return
+		}
+	}
+
+	var req ItemUpdateRequest
+	fieldErrors := assignJSONFields(raw, &req)
+	if fieldErrors = req.validate(fieldErrors); len(fieldErrors) > 0 {
+		writeValidationErrors(w, r, fieldErrors)
+		return
+	}
+
+	s.writeUpdatedItem(w, r.WithContext(ctx), id, req)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page size bounds for ListItems
+const (
+	defaultPageSize = 10
+	minPageSize     = 1
+	maxPageSize     = 100
+)
+
+// listQuery is a validated ListItems query
+type listQuery struct {
+	filters  listFilters
+	fields   fieldSet
+	pageSize int32
+	// pageToken is the cursor sent by the client, not yet verified
+	pageToken string
+}
+
+// parseListQuery validates the ListItems query parameters
+func parseListQuery(r *http.Request) (listQuery, []FieldError) {
+	query := r.URL.Query()
+	filters, fieldErrors := parseListFilters(r)
+	fields, fieldSetErrors := parseFieldSet(r)
+	parsed := listQuery{
+		filters:   filters,
+		fields:    fields,
+		pageSize:  defaultPageSize,
+		pageToken: query.Get("page_token"),
+	}
+	v := newValidator(append(fieldErrors, fieldSetErrors...))
+
+	if raw := query.Get("page_size"); raw != "" {
+		pageSize, err := strconv.Atoi(raw)
+		v.check(err == nil && pageSize >= minPageSize && pageSize <= maxPageSize,
+			"page_size", "must be an integer between %d and %d", minPageSize, maxPageSize)
+		parsed.pageSize = int32(pageSize)
+	}
+	return parsed, v.errors
+}
+
+// writeListError reports a failure of listItems
+func writeListError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errTooManyToSort) {
+		writeQueryErrors(w, r, []FieldError{{
+			Field:   "sort",
+			Message: fmt.Sprintf("is only supported for listings of at most %d items; narrow the filters", maxSortedItems),
+		}})
+		return
+	}
+	log.Printf("Error listing items: %v", err)
+	writeStoreError(w, r, err, "Failed to list items")
+}
+
+// writeQueryErrors reports invalid query parameters with 400
+func writeQueryErrors(w http.ResponseWriter, r *http.Request, fieldErrors []FieldError) {
+	problem := newProblem(r, http.StatusBadRequest, CodeInvalidQuery, "Query parameter validation failed")
+	problem.Errors = fieldErrors
+	writeProblem(w, problem)
+}
+
+// setPaginationLinks sets an RFC 8288 Link header with the first page of the
+// listing and, if there is one, the next page
+func setPaginationLinks(w http.ResponseWriter, r *http.Request, nextPageToken string) {
+	pageURL := func(pageToken string) string {
+		query := r.URL.Query()
+		query.Del("page_token")
+		if pageToken != "" {
+			query.Set("page_token", pageToken)
+		}
+		link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return link.String()
+	}
+
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(""))}
+	if nextPageToken != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(nextPageToken)))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
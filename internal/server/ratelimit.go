@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/auth"
+	"github.com/rinsecrm/api-service/internal/metrics"
+	"github.com/rinsecrm/api-service/internal/ratelimit"
+)
+
+// RateLimit enforces the request limit of the caller's plan, per tenant and
+// optionally per user and route. It must run after Authenticate.
+func (s *Server) RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := auth.FromContext(r.Context())
+		limit, limited := s.rateLimitFor(identity)
+		if s.rateLimiter == nil || !limited {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := s.rateLimiter.Allow(r.Context(), s.rateLimitKey(r, identity), limit)
+		if err != nil {
+			// Failing open keeps the API up when a shared limiter is not
+			log.Printf("Rate limiter failed for tenant %d: %v", identity.TenantID, err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		setRateLimitHeaders(w, result)
+		if !result.Allowed {
+			metrics.RecordRateLimited(strconv.FormatInt(identity.TenantID, 10))
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			writeErrorResponse(w, r, http.StatusTooManyRequests, CodeRateLimited, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitFor returns the limit of the identity's plan, falling back to the
+// default plan for tokens without a known one
+func (s *Server) rateLimitFor(identity auth.Identity) (ratelimit.Limit, bool) {
+	if limit, ok := s.rateLimitPlans[identity.Plan]; ok {
+		return limit, true
+	}
+	limit, ok := s.rateLimitPlans[s.defaultPlan]
+	return limit, ok
+}
+
+func (s *Server) rateLimitKey(r *http.Request, identity auth.Identity) string {
+	key := "tenant:" + strconv.FormatInt(identity.TenantID, 10)
+	if s.rateLimitByUser {
+		key += "|user:" + identity.Subject
+	}
+	if s.rateLimitByRoute {
+		key += "|route:" + r.Method + " " + routeTemplate(r)
+	}
+	return key
+}
+
+// setRateLimitHeaders describes the caller's quota with the RateLimit header
+// fields of the IETF httpapi draft
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit.Burst, ceilSeconds(result.Limit.Window())))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/rinsecrm/api-service/internal/metrics"
+)
+
+// Router registers every route the service serves. The API routes are
+// authenticated, rate limited and authorized against routePermissions.
+func (s *Server) Router() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(s.NotFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(s.MethodNotAllowed)
+
+	// API routes
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(s.RequestTimeout, s.Authenticate, s.RateLimit, s.Authorize)
+	api.HandleFunc("/items", s.Idempotent(s.CreateItem)).Methods("POST")
+	api.HandleFunc("/items", s.ListItems).Methods("GET")
+	api.HandleFunc("/items:batch", s.Idempotent(s.BatchItems)).Methods("POST")
+	api.HandleFunc("/items/import", s.ImportItems).Methods("POST")
+	api.HandleFunc("/items/export", s.ExportItems).Methods("GET")
+	api.HandleFunc("/items/{id}", s.GetItem).Methods("GET")
+	api.HandleFunc("/items/{id}", s.UpdateItem).Methods("PUT")
+	api.HandleFunc("/items/{id}", s.PatchItem).Methods("PATCH")
+	api.HandleFunc("/items/{id}", s.DeleteItem).Methods("DELETE")
+	api.HandleFunc("/items/{id}/inventory", s.Idempotent(s.UpdateInventory)).Methods("PATCH")
+	api.HandleFunc("/jobs/imports", s.SubmitImportJob).Methods("POST")
+	api.HandleFunc("/jobs/exports", s.SubmitExportJob).Methods("POST")
+	api.HandleFunc("/jobs/{id}", s.GetJob).Methods("GET")
+	api.HandleFunc("/jobs/{id}", s.CancelJob).Methods("DELETE")
+	api.HandleFunc("/jobs/{id}/result", s.GetJobResult).Methods("GET")
+
+	// Health check
+	r.HandleFunc("/health", s.HealthCheck).Methods("GET")
+
+	// Metrics endpoint
+	r.Handle("/metrics", metrics.MetricsHandler()).Methods("GET")
+	return r
+}
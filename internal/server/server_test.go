@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rinsecrm/api-service/internal/auth"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/idempotency"
+	"github.com/rinsecrm/api-service/internal/jobs"
+)
+
+const (
+	testSecret = "test-secret"
+	testTenant = int64(1)
+)
+
+// testServer serves the full router
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+// newTestServer serves the router over an in-memory store
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWithStore(t, client.NewMemoryStore())
+}
+
+// newTestServerWithStore serves the router over store, with the config
+// changed by each of configure
+func newTestServerWithStore(t *testing.T, store client.Store, configure ...func(*Config)) *testServer {
+	t.Helper()
+	verifier, err := auth.NewVerifier(context.Background(), auth.Config{HMACSecret: testSecret})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	jobManager := jobs.NewManager(jobs.NewMemoryStore(), jobs.Config{
+		Workers:   1,
+		QueueSize: 10,
+		Retention: time.Hour,
+		ResultDir: t.TempDir(),
+	})
+	t.Cleanup(func() { jobManager.Stop(context.Background()) })
+
+	config := Config{
+		Verifier:         verifier,
+		IdempotencyStore: idempotency.NewMemoryStore(),
+		Jobs:             jobManager,
+		CursorSecret:     []byte("cursor-secret"),
+	}
+	for _, change := range configure {
+		change(&config)
+	}
+	srv := NewServer(store, config)
+	return &testServer{t: t, handler: srv.Router()}
+}
+
+// signToken issues an HS256 token for a user of tenantID with roles
+func signToken(t *testing.T, tenantID int64, roles ...string) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"sub":       "user-1",
+		"tenant_id": tenantID,
+		"roles":     roles,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newRequest builds a request made by an admin of testTenant
+func (ts *testServer) newRequest(method, target, contentType, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+signToken(ts.t, testTenant, auth.RoleAdmin))
+	return req
+}
+
+func (ts *testServer) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ts.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// do makes a request as an admin of testTenant
+func (ts *testServer) do(method, target, contentType, body string) *httptest.ResponseRecorder {
+	return ts.serve(ts.newRequest(method, target, contentType, body))
+}
+
+// createItem creates an item through the API and returns it
+func (ts *testServer) createItem(body string) ItemResponse {
+	ts.t.Helper()
+	rec := ts.do(http.MethodPost, "/api/v1/items", "application/json", body)
+	if rec.Code != http.StatusCreated {
+		ts.t.Fatalf("create item: status %d: %s", rec.Code, rec.Body)
+	}
+	return decodeResponse[ItemResponse](ts.t, rec)
+}
+
+func decodeResponse[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(rec.Body.Bytes(), &value); err != nil {
+		t.Fatalf("decode response %q: %v", rec.Body, err)
+	}
+	return value
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, want, rec.Body)
+	}
+}
+
+// expectProblem checks a problem response's status and code
+func expectProblem(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	expectStatus(t, rec, status)
+	if contentType := rec.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Fatalf("Content-Type = %q, want %q", contentType, problemContentType)
+	}
+	if problem := decodeResponse[ErrorResponse](t, rec); problem.Code != code {
+		t.Fatalf("code = %q, want %q", problem.Code, code)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	ts := newTestServer(t)
+	rec := ts.serve(httptest.NewRequest(http.MethodGet, "/health", nil))
+	expectStatus(t, rec, http.StatusOK)
+	if body := decodeResponse[map[string]string](t, rec); body["status"] != "healthy" {
+		t.Fatalf("status = %q, want healthy", body["status"])
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ts := newTestServer(t)
+	ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	rec := ts.serve(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), "items_created_total") {
+		t.Fatal("metrics do not include items_created_total")
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	ts := newTestServer(t)
+	expectProblem(t, ts.do(http.MethodGet, "/api/v2/items", "", ""), http.StatusNotFound, CodeNotFound)
+	expectProblem(t, ts.do(http.MethodPost, "/health", "", ""), http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+}
+
+func TestAuthentication(t *testing.T) {
+	ts := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+	rec := ts.serve(req)
+	expectProblem(t, rec, http.StatusUnauthorized, CodeUnauthenticated)
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatal("missing WWW-Authenticate header")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant, auth.RoleAdmin)+"x")
+	expectProblem(t, ts.serve(req), http.StatusUnauthorized, CodeUnauthenticated)
+}
+
+func TestAuthorization(t *testing.T) {
+	ts := newTestServer(t)
+
+	req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant, auth.RoleViewer))
+	expectProblem(t, ts.serve(req), http.StatusForbidden, CodeForbidden)
+
+	req = ts.newRequest(http.MethodGet, "/api/v1/items", "", "")
+	req.Header.Set("Authorization", "Bearer "+signToken(t, testTenant, auth.RoleViewer))
+	expectStatus(t, ts.serve(req), http.StatusOK)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	ts := newTestServer(t)
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	other := "Bearer " + signToken(t, testTenant+1, auth.RoleAdmin)
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		req := ts.newRequest(method, "/api/v1/items/"+item.ID, "", "")
+		req.Header.Set("Authorization", other)
+		expectProblem(t, ts.serve(req), http.StatusNotFound, CodeNotFound)
+	}
+
+	req := ts.newRequest(http.MethodGet, "/api/v1/items", "", "")
+	req.Header.Set("Authorization", other)
+	rec := ts.serve(req)
+	expectStatus(t, rec, http.StatusOK)
+	if list := decodeResponse[ListResponse](t, rec); len(list.Items) != 0 {
+		t.Fatalf("other tenant lists %d items, want 0", len(list.Items))
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/rinsecrm/api-service/internal/canaryctx"
+	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/storetest"
+)
+
+// newGRPCTestServer serves the router over a real store client connected to
+// an in-process store, with the canary middleware main adds in front
+func newGRPCTestServer(t *testing.T, config client.Config) (*testServer, *storetest.Server) {
+	t.Helper()
+	storeServer := storetest.NewServer()
+	t.Cleanup(storeServer.Close)
+
+	config.RetryBackoff = time.Millisecond
+	store, err := storeServer.NewClient(config)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	ts := newTestServerWithStore(t, store)
+	ts.handler = canaryctx.HTTPMiddleware(ts.handler)
+	return ts, storeServer
+}
+
+func TestStoreErrorMapping(t *testing.T) {
+	ts, storeServer := newGRPCTestServer(t, client.Config{MaxAttempts: 1})
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+	target := "/api/v1/items/" + item.ID
+
+	tests := []struct {
+		code   codes.Code
+		status int
+		want   string
+	}{
+		{codes.NotFound, http.StatusNotFound, CodeNotFound},
+		{codes.InvalidArgument, http.StatusBadRequest, CodeInvalidArgument},
+		{codes.AlreadyExists, http.StatusConflict, CodeAlreadyExists},
+		{codes.FailedPrecondition, http.StatusPreconditionFailed, CodePreconditionFail},
+		{codes.PermissionDenied, http.StatusForbidden, CodePermissionDenied},
+		{codes.ResourceExhausted, http.StatusTooManyRequests, CodeResourceExhausted},
+		{codes.Unavailable, http.StatusServiceUnavailable, CodeUnavailable},
+		{codes.Unimplemented, http.StatusNotImplemented, CodeUnimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			storeServer.Inject("GetItem", storetest.Fault{Code: tt.code, Times: 1})
+			expectProblem(t, ts.do(http.MethodGet, target, "", ""), tt.status, tt.want)
+		})
+	}
+}
+
+func TestStoreRetriesThroughOutage(t *testing.T) {
+	ts, storeServer := newGRPCTestServer(t, client.Config{MaxAttempts: 3})
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	storeServer.Inject("GetItem", storetest.Fault{Code: codes.Unavailable, Times: 2})
+	expectStatus(t, ts.do(http.MethodGet, "/api/v1/items/"+item.ID, "", ""), http.StatusOK)
+	if calls := len(storeServer.Calls("GetItem")); calls != 3 {
+		t.Fatalf("got %d calls, want 3", calls)
+	}
+}
+
+func TestStoreRequestTimeout(t *testing.T) {
+	ts, storeServer := newGRPCTestServer(t, client.Config{MaxAttempts: 1})
+	item := ts.createItem(`{"name":"Lamp","price":10,"category":"home"}`)
+
+	storeServer.Inject("GetItem", storetest.Fault{Delay: time.Second})
+	req := ts.newRequest(http.MethodGet, "/api/v1/items/"+item.ID, "", "")
+	req.Header.Set("X-Request-Timeout", "50ms")
+	start := time.Now()
+	expectProblem(t, ts.serve(req), http.StatusGatewayTimeout, CodeDeadlineExceeded)
+
+	// The budget, not the store client's 10s call timeout, reaches the
+	// store; gRPC rounds the deadline it sends up slightly
+	calls := storeServer.Calls("GetItem")
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	if deadline := calls[0].Deadline; deadline.IsZero() || deadline.After(start.Add(100*time.Millisecond)) {
+		t.Fatalf("store saw deadline %v, want about 50ms after %v", deadline, start)
+	}
+}
+
+func TestParseRequestTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"500ms", 500 * time.Millisecond, true},
+		{"2", 2 * time.Second, true},
+		{"0.25", 250 * time.Millisecond, true},
+		{"1e20", time.Minute, true},
+		{"2h", time.Minute, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"1e-12", 0, false},
+		{"Inf", 0, false},
+		{"NaN", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRequestTimeout(tt.value, time.Minute)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("parseRequestTimeout(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestStoreCanaryPropagation(t *testing.T) {
+	ts, storeServer := newGRPCTestServer(t, client.Config{})
+
+	req := ts.newRequest(http.MethodPost, "/api/v1/items", "application/json", `{"name":"Lamp","price":10,"category":"home"}`)
+	req.Header.Set(canaryctx.CanaryHeader, "42")
+	req.Header.Set("Idempotency-Key", "create-lamp")
+	expectStatus(t, ts.serve(req), http.StatusCreated)
+
+	calls := storeServer.Calls("CreateItem")
+	if len(calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(calls))
+	}
+	if got := calls[0].Metadata.Get(canaryctx.CanaryHeaderGRPC); len(got) != 1 || got[0] != "42" {
+		t.Fatalf("canary metadata = %v, want [42]", got)
+	}
+	if got := calls[0].Metadata.Get("idempotency-key"); len(got) != 1 {
+		t.Fatalf("idempotency-key metadata = %v, want one key", got)
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// defaultMaxRequestTimeout applies when Config.MaxRequestTimeout is unset
+const defaultMaxRequestTimeout = time.Minute
+
+// RequestTimeout gives the request the time budget in its X-Request-Timeout
+// header, as a duration such as "1.5s" or a number of seconds, capped at the
+// configured maximum. Store calls get what remains of the budget, and a
+// request that runs out of it is answered with 504. Requests without the
+// header are bounded only by the store client's call timeouts.
+func (s *Server) RequestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(requestTimeoutHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		budget, ok := parseRequestTimeout(value, s.maxRequestTimeout)
+		if !ok {
+			writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidRequestTimeout,
+				fmt.Sprintf("%s must be a positive duration, such as 2s or 500ms", requestTimeoutHeader))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), budget)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseRequestTimeout reads an X-Request-Timeout value, capped at max. A
+// number of seconds is capped before it is converted, so that huge values do
+// not overflow; values that are not finite or round to zero are rejected.
+func parseRequestTimeout(value string, max time.Duration) (time.Duration, bool) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return 0, false
+		}
+		budget := time.Duration(min(seconds, max.Seconds()) * float64(time.Second))
+		return budget, budget > 0
+	}
+	budget, err := time.ParseDuration(value)
+	return min(budget, max), err == nil && budget > 0
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation limits for item payloads
+const (
+	maxRequestBodyBytes  = 1 << 20
+	maxNameLength        = 200
+	maxDescriptionLength = 2000
+	maxSKULength         = 64
+	maxTags              = 20
+	maxTagLength         = 50
+	maxReasonLength      = 500
+	maxPrice             = 1_000_000_000
+	priceDecimals        = 2
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// errBodyTooLarge is returned by readBody when the body exceeds its limit
+var errBodyTooLarge = errors.New("request body too large")
+
+// decodeJSONBody decodes a JSON object into dst, which must be a pointer to a
+// struct. Syntax errors are returned as err; unknown fields and values of the
+// wrong type are returned together as field errors.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) ([]FieldError, error) {
+	body, err := readBody(w, r, maxRequestBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	return assignJSONFields(fields, dst), nil
+}
+
+// readBody reads the whole request body, failing with errBodyTooLarge past limit
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errBodyTooLarge
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// assignJSONFields unmarshals each member of fields into the struct field of
+// dst with the matching json tag, collecting a FieldError per bad member.
+// Like encoding/json, names match tags case-insensitively, and an exact
+// match is preferred when both are present.
+func assignJSONFields(fields map[string]json.RawMessage, dst interface{}) []FieldError {
+	target := reflect.ValueOf(dst).Elem()
+	byName := make(map[string]reflect.Value, target.NumField())
+	for i := 0; i < target.NumField(); i++ {
+		name, _, _ := strings.Cut(target.Type().Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			byName[name] = target.Field(i)
+		}
+	}
+	lookup := func(name string) (reflect.Value, bool) {
+		if field, ok := byName[name]; ok {
+			return field, true
+		}
+		for tag, field := range byName {
+			if strings.EqualFold(tag, name) {
+				return field, true
+			}
+		}
+		return reflect.Value{}, false
+	}
+
+	// Exact matches are assigned last, so they win over other spellings
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		_, iExact := byName[names[i]]
+		_, jExact := byName[names[j]]
+		if iExact != jExact {
+			return jExact
+		}
+		return names[i] < names[j]
+	})
+
+	var fieldErrors []FieldError
+	for _, name := range names {
+		raw := fields[name]
+		field, ok := lookup(name)
+		if !ok {
+			fieldErrors = append(fieldErrors, FieldError{Field: name, Message: "is not a recognised field"})
+			continue
+		}
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			fieldErrors = append(fieldErrors, FieldError{Field: name, Message: "must be " + jsonTypeName(field.Type())})
+		}
+	}
+	return fieldErrors
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("an integer between %d and %d", int64(-1)<<(t.Bits()-1), int64(1)<<(t.Bits()-1)-1)
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice:
+		return "an array of " + strings.TrimPrefix(strings.TrimPrefix(jsonTypeName(t.Elem()), "a "), "an ") + "s"
+	default:
+		return "a valid " + t.String()
+	}
+}
+
+// writeDecodeError reports a decodeJSONBody failure
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errBodyTooLarge) {
+		writeErrorResponse(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body is too large")
+		return
+	}
+	writeErrorResponse(w, r, http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON: "+err.Error())
+}
+
+// writeValidationErrors reports field-level violations with 422
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, fieldErrors []FieldError) {
+	problem := newProblem(r, http.StatusUnprocessableEntity, CodeValidationFailed, "Request validation failed")
+	problem.Errors = fieldErrors
+	writeProblem(w, problem)
+}
+
+// validator accumulates field errors, reporting at most one error per field
+type validator struct {
+	errors []FieldError
+	failed map[string]bool
+}
+
+func newValidator(existing []FieldError) *validator {
+	v := &validator{failed: make(map[string]bool)}
+	for _, fieldError := range existing {
+		v.addError(fieldError)
+	}
+	return v
+}
+
+func (v *validator) addError(fieldError FieldError) {
+	if v.failed[fieldError.Field] {
+		return
+	}
+	v.failed[fieldError.Field] = true
+	v.errors = append(v.errors, fieldError)
+}
+
+// check records message against field when ok is false
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.addError(FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (v *validator) name(name string) {
+	v.check(strings.TrimSpace(name) != "", "name", "is required")
+	v.check(utf8.RuneCountInString(name) <= maxNameLength, "name", "must be at most %d characters", maxNameLength)
+}
+
+func (v *validator) description(description string) {
+	v.check(utf8.RuneCountInString(description) <= maxDescriptionLength, "description", "must be at most %d characters", maxDescriptionLength)
+}
+
+func (v *validator) price(price float64) {
+	v.check(price >= 0, "price", "must not be negative")
+	v.check(price <= maxPrice, "price", "must not exceed %d", maxPrice)
+	scaled := price * math.Pow10(priceDecimals)
+	v.check(math.Abs(scaled-math.Round(scaled)) < 1e-6, "price", "must have at most %d decimal places", priceDecimals)
+}
+
+func (v *validator) category(category string) {
+	_, ok := parseCategory(category)
+	v.check(ok, "category", "must be one of %s", strings.Join(categoryNames, ", "))
+}
+
+func (v *validator) status(status string) {
+	_, ok := parseStatus(status)
+	v.check(ok, "status", "must be one of %s", strings.Join(statusNames, ", "))
+}
+
+func (v *validator) sku(sku string) {
+	if sku == "" {
+		return
+	}
+	v.check(len(sku) <= maxSKULength, "sku", "must be at most %d characters", maxSKULength)
+	v.check(skuPattern.MatchString(sku), "sku", "must contain only letters, digits, '.', '_' or '-' and start with a letter or digit")
+}
+
+func (v *validator) inventoryCount(count int32) {
+	v.check(count >= 0, "inventory_count", "must not be negative")
+}
+
+func (v *validator) tags(tags []string) {
+	v.check(len(tags) <= maxTags, "tags", "must contain at most %d tags", maxTags)
+	seen := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		v.check(strings.TrimSpace(tag) != "", field, "must not be empty")
+		v.check(utf8.RuneCountInString(tag) <= maxTagLength, field, "must be at most %d characters", maxTagLength)
+		v.check(!seen[tag], field, "duplicates tag %q", tag)
+		seen[tag] = true
+	}
+}
+
+func (req ItemRequest) validate(existing []FieldError) []FieldError {
+	v := newValidator(existing)
+	v.name(req.Name)
+	v.description(req.Description)
+	v.price(req.Price)
+	v.category(req.Category)
+	v.sku(req.SKU)
+	v.inventoryCount(req.InventoryCount)
+	v.tags(req.Tags)
+	return v.errors
+}
+
+func (req ItemUpdateRequest) validate(existing []FieldError) []FieldError {
+	v := newValidator(existing)
+	v.name(req.Name)
+	v.description(req.Description)
+	v.price(req.Price)
+	v.category(req.Category)
+	v.status(req.Status)
+	v.sku(req.SKU)
+	v.inventoryCount(req.InventoryCount)
+	v.tags(req.Tags)
+	return v.errors
+}
+
+func (req InventoryUpdateRequest) validate(existing []FieldError) []FieldError {
+	v := newValidator(existing)
+	v.check(utf8.RuneCountInString(req.Reason) <= maxReasonLength, "reason", "must be at most %d characters", maxReasonLength)
+	return v.errors
+}
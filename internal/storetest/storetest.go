@@ -0,0 +1,212 @@
+// Package storetest runs a store-service fake in process, over an in-memory
+// connection, so tests can exercise the real store client end to end
+package storetest
+
+import (
+	"context"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/rinsecrm/api-service/internal/client"
+	pb "github.com/rinsecrm/api-service/proto/go"
+)
+
+const bufferSize = 1 << 20
+
+// Fault is injected into calls to one store method. The call waits Delay,
+// or until it is canceled, and then fails with Code if it is set.
+type Fault struct {
+	Delay   time.Duration
+	Code    codes.Code
+	Message string
+	// Times limits the fault to the next Times calls; 0 injects it into
+	// every call until it is cleared
+	Times int
+}
+
+// Call is a request received by the server, with its incoming metadata
+type Call struct {
+	Method   string
+	Request  proto.Message
+	Metadata metadata.MD
+	// Deadline is the deadline the call arrived with, zero if it had none
+	Deadline time.Time
+}
+
+// Server serves StoreService over bufconn, answering from a MemoryStore
+type Server struct {
+	pb.UnimplementedStoreServiceServer
+
+	// Store holds the server's items; tests may seed it directly
+	Store *client.MemoryStore
+
+	listener *bufconn.Listener
+	server   *grpc.Server
+
+	mu     sync.Mutex
+	faults map[string]*Fault
+	calls  []Call
+}
+
+// NewServer starts a server; Close stops it
+func NewServer() *Server {
+	s := &Server{
+		Store:    client.NewMemoryStore(),
+		listener: bufconn.Listen(bufferSize),
+		faults:   make(map[string]*Fault),
+	}
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.intercept))
+	pb.RegisterStoreServiceServer(s.server, s)
+	go s.server.Serve(s.listener)
+	return s
+}
+
+// Close stops the server, failing calls in flight
+func (s *Server) Close() {
+	s.server.Stop()
+}
+
+// DialOptions connect a client to the server
+func (s *Server) DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.listener.DialContext(ctx)
+		}),
+	}
+}
+
+// NewClient creates a store client connected to the server, through the
+// same NewStoreClient path as the service
+func (s *Server) NewClient(config client.Config) (*client.StoreClient, error) {
+	config.DialOptions = append(config.DialOptions, s.DialOptions()...)
+	return client.NewStoreClient("passthrough:///bufnet", config)
+}
+
+// Inject sets the fault for method, e.g. "GetItem", replacing any other
+func (s *Server) Inject(method string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = &fault
+}
+
+// ClearFaults removes every injected fault
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+}
+
+// Calls returns the calls received for method, or for every method if it
+// is empty, in the order they arrived
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// intercept records each call and applies its method's fault
+func (s *Server) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := path.Base(info.FullMethod)
+	md, _ := metadata.FromIncomingContext(ctx)
+	deadline, _ := ctx.Deadline()
+	fault := s.record(Call{Method: method, Request: proto.Clone(req.(proto.Message)), Metadata: md.Copy(), Deadline: deadline})
+
+	if fault.Delay > 0 {
+		timer := time.NewTimer(fault.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if fault.Code != codes.OK {
+		message := fault.Message
+		if message == "" {
+			message = "injected " + fault.Code.String()
+		}
+		return nil, status.Error(fault.Code, message)
+	}
+	return handler(ctx, req)
+}
+
+// record adds call to the log and returns the fault to apply to it
+func (s *Server) record(call Call) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+
+	fault, ok := s.faults[call.Method]
+	if !ok {
+		return Fault{}
+	}
+	if fault.Times > 0 {
+		if fault.Times--; fault.Times == 0 {
+			delete(s.faults, call.Method)
+		}
+	}
+	return *fault
+}
+
+func (s *Server) CreateItem(ctx context.Context, req *pb.CreateItemRequest) (*pb.CreateItemResponse, error) {
+	item, err := s.Store.CreateItem(ctx, req.TenantId, req.Name, req.Description, req.Price, req.Category, req.Sku, req.InventoryCount, req.Tags, req.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateItemResponse{Item: item}, nil
+}
+
+func (s *Server) GetItem(ctx context.Context, req *pb.GetItemRequest) (*pb.GetItemResponse, error) {
+	item, err := s.Store.GetItem(ctx, req.TenantId, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetItemResponse{Item: item}, nil
+}
+
+func (s *Server) UpdateItem(ctx context.Context, req *pb.UpdateItemRequest) (*pb.UpdateItemResponse, error) {
+	item, err := s.Store.UpdateItem(ctx, req.TenantId, req.Id, req.Name, req.Description, req.Price, req.Category, req.Status, req.Sku, req.InventoryCount, req.Tags, req.UpdatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateItemResponse{Item: item}, nil
+}
+
+func (s *Server) DeleteItem(ctx context.Context, req *pb.DeleteItemRequest) (*pb.DeleteItemResponse, error) {
+	deleted, err := s.Store.DeleteItem(ctx, req.TenantId, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteItemResponse{Success: deleted}, nil
+}
+
+func (s *Server) ListItems(ctx context.Context, req *pb.ListItemsRequest) (*pb.ListItemsResponse, error) {
+	items, nextPageToken, totalCount, err := s.Store.ListItems(ctx, req.TenantId, req.Category, req.Status, req.SearchQuery, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ListItemsResponse{Items: items, NextPageToken: nextPageToken, TotalCount: totalCount}, nil
+}
+
+func (s *Server) UpdateInventory(ctx context.Context, req *pb.UpdateInventoryRequest) (*pb.UpdateInventoryResponse, error) {
+	item, previousCount, err := s.Store.UpdateInventory(ctx, req.TenantId, req.ItemId, req.QuantityChange, req.Reason, req.UpdatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateInventoryResponse{Item: item, PreviousCount: previousCount}, nil
+}
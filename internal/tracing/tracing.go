@@ -113,3 +113,13 @@ func GetTracer() trace.Tracer {
 func IsEnabled() bool {
 	return tracerProvider != nil
 }
+
+// TraceIDFromContext returns the hex trace ID of the span in context, or an
+// empty string if there is no valid span
+func TraceIDFromContext(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,139 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of an .xlsx file
+const ContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+const (
+	contentTypesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+	rootRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	workbookRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+	workbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	sheetHeaderXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	sheetFooterXML = `</sheetData></worksheet>`
+)
+
+// maxSheetNameLength is the longest sheet name spreadsheet applications accept
+const maxSheetNameLength = 31
+
+// Writer streams rows into the single worksheet of a workbook
+type Writer struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+// NewWriter writes the workbook parts that precede the worksheet to w
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	if len(sheetName) > maxSheetNameLength {
+		sheetName = sheetName[:maxSheetNameLength]
+	}
+	var name strings.Builder
+	if err := xml.EscapeText(&name, []byte(sheetName)); err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypesXML},
+		{"_rels/.rels", rootRelsXML},
+		{"xl/workbook.xml", fmt.Sprintf(workbookXML, name.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRelsXML},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sheet, sheetHeaderXML); err != nil {
+		return nil, err
+	}
+	return &Writer{zip: zw, sheet: sheet}, nil
+}
+
+// WriteRow appends a row. Values may be strings or numbers; any other value
+// is written as text using its default format. Text is always an inline
+// string, never a formula, so a value such as "=1+1" is shown as written.
+func (w *Writer) WriteRow(values ...interface{}) error {
+	w.rows++
+	var row strings.Builder
+	fmt.Fprintf(&row, `<row r="%d">`, w.rows)
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.rows)
+		switch v := value.(type) {
+		case float64:
+			fmt.Fprintf(&row, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			fmt.Fprintf(&row, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int32:
+			fmt.Fprintf(&row, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(&row, `<c r="%s"><v>%d</v></c>`, ref, v)
+		default:
+			text, ok := value.(string)
+			if !ok {
+				text = fmt.Sprint(value)
+			}
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&row, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&row, []byte(text))
+			row.WriteString(`</t></is></c>`)
+		}
+	}
+	row.WriteString(`</row>`)
+	_, err := io.WriteString(w.sheet, row.String())
+	return err
+}
+
+// Flush writes buffered archive data to the underlying writer
+func (w *Writer) Flush() error {
+	return w.zip.Flush()
+}
+
+// Close completes the worksheet and the archive. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if _, err := io.WriteString(w.sheet, sheetFooterXML); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
+
+// columnName converts a zero-based column index to its letters: A, B, ... Z, AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
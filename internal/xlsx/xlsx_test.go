@@ -0,0 +1,132 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// sheetXML returns the worksheet of a written workbook
+func sheetXML(t *testing.T, workbook []byte) string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(workbook), int64(len(workbook)))
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	names := map[string]bool{}
+	var sheet string
+	for _, f := range archive.File {
+		names[f.Name] = true
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open sheet: %v", err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("read sheet: %v", err)
+		}
+		sheet = string(content)
+	}
+	for _, part := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if !names[part] {
+			t.Fatalf("workbook has no %s", part)
+		}
+	}
+	return sheet
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Items")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.WriteRow("name", "price", "count"); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.WriteRow("Lamp & <Shade>", 12.5, int32(3), "", int64(7)); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	sheet := sheetXML(t, buf.Bytes())
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Lamp &amp; &lt;Shade&gt;</t></is></c>`,
+		`<c r="B2"><v>12.5</v></c>`,
+		`<c r="C2"><v>3</v></c>`,
+		`<c r="E2"><v>7</v></c></row>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Fatalf("sheet does not contain %s:\n%s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="D2"`) {
+		t.Fatal("empty text was written as a cell")
+	}
+}
+
+func TestWriterNeverWritesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Items")
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.WriteRow("=SUM(A1:A9)", "+1", "@cmd"); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	sheet := sheetXML(t, buf.Bytes())
+	if strings.Contains(sheet, "<f>") {
+		t.Fatalf("sheet contains a formula:\n%s", sheet)
+	}
+	if !strings.Contains(sheet, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">=SUM(A1:A9)</t></is></c>`) {
+		t.Fatalf("formula text was not written as an inline string:\n%s", sheet)
+	}
+}
+
+func TestSheetNameTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, strings.Repeat("x", 40))
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open workbook: %v", err)
+	}
+	for _, f := range archive.File {
+		if f.Name != "xl/workbook.xml" {
+			continue
+		}
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		if !strings.Contains(string(content), `name="`+strings.Repeat("x", maxSheetNameLength)+`"`) {
+			t.Fatalf("sheet name not truncated to %d: %s", maxSheetNameLength, content)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
@@ -7,16 +7,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	"github.com/rinsecrm/api-service/internal/auth"
 	"github.com/rinsecrm/api-service/internal/canaryctx"
 	"github.com/rinsecrm/api-service/internal/client"
+	"github.com/rinsecrm/api-service/internal/idempotency"
+	"github.com/rinsecrm/api-service/internal/jobs"
 	"github.com/rinsecrm/api-service/internal/metrics"
+	"github.com/rinsecrm/api-service/internal/ratelimit"
 	"github.com/rinsecrm/api-service/internal/server"
 	"github.com/rinsecrm/api-service/internal/tracing"
 )
@@ -36,40 +40,89 @@ func main() {
 		log.Printf("Failed to initialize tracing: %v", err)
 	}
 
+	// Load per-method store call timeouts
+	methodTimeouts, err := client.ParseMethodTimeouts(os.Getenv("STORE_METHOD_TIMEOUTS"))
+	if err != nil {
+		log.Fatalf("Failed to parse STORE_METHOD_TIMEOUTS: %v", err)
+	}
+
 	// Initialize store client
-	storeClient, err := client.NewStoreClient(storeServiceAddr)
+	storeClient, err := client.NewStoreClient(storeServiceAddr, client.Config{
+		CacheSize:       getIntEnvOrDefault("CACHE_SIZE", 10000),
+		CacheTTL:        getDurationEnvOrDefault("CACHE_TTL", 30*time.Second),
+		MaxAttempts:     getIntEnvOrDefault("STORE_MAX_ATTEMPTS", 3),
+		RetryBackoff:    getDurationEnvOrDefault("STORE_RETRY_BACKOFF", 50*time.Millisecond),
+		MaxRetryBackoff: getDurationEnvOrDefault("STORE_MAX_RETRY_BACKOFF", time.Second),
+		HedgeDelay:      getDurationEnvOrDefault("STORE_HEDGE_DELAY", 0),
+		BreakerFailures: getIntEnvOrDefault("STORE_BREAKER_FAILURES", 5),
+		BreakerCooldown: getDurationEnvOrDefault("STORE_BREAKER_COOLDOWN", 10*time.Second),
+		BreakerProbes:   getIntEnvOrDefault("STORE_BREAKER_PROBES", 1),
+		CallTimeout:     getDurationEnvOrDefault("STORE_CALL_TIMEOUT", 10*time.Second),
+		MethodTimeouts:  methodTimeouts,
+		StaleCacheSize:  getIntEnvOrDefault("STALE_CACHE_SIZE", 10000),
+		StaleTTL:        getDurationEnvOrDefault("STALE_TTL", time.Hour),
+	})
 	if err != nil {
 		log.Fatalf("Failed to create store client: %v", err)
 	}
 	defer storeClient.Close()
 
-	// Create server
-	srv := server.NewServer(storeClient)
+	// Initialize token verification
+	verifier, err := auth.NewVerifier(context.Background(), auth.Config{
+		HMACSecret:          os.Getenv("AUTH_HS256_SECRET"),
+		JWKSFile:            os.Getenv("AUTH_JWKS_FILE"),
+		JWKSURL:             os.Getenv("AUTH_JWKS_URL"),
+		JWKSRefreshInterval: getDurationEnvOrDefault("AUTH_JWKS_REFRESH_INTERVAL", 15*time.Minute),
+		Issuer:              os.Getenv("AUTH_ISSUER"),
+		Audience:            os.Getenv("AUTH_AUDIENCE"),
+		TenantClaim:         getEnvOrDefault("AUTH_TENANT_CLAIM", "tenant_id"),
+		RolesClaim:          getEnvOrDefault("AUTH_ROLES_CLAIM", "roles"),
+		PlanClaim:           getEnvOrDefault("AUTH_PLAN_CLAIM", "plan"),
+		Leeway:              getDurationEnvOrDefault("AUTH_CLOCK_SKEW", 30*time.Second),
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
 
-	// Setup routes
-	r := mux.NewRouter()
+	// Load per-plan rate limits
+	rateLimitPlans, err := ratelimit.ParsePlans(os.Getenv("RATE_LIMIT_PLANS"))
+	if err != nil {
+		log.Fatalf("Failed to parse RATE_LIMIT_PLANS: %v", err)
+	}
 
-	// API routes
-	api := r.PathPrefix("/api/v1").Subrouter()
-	api.HandleFunc("/items", srv.CreateItem).Methods("POST")
-	api.HandleFunc("/items", srv.ListItems).Methods("GET")
-	api.HandleFunc("/items/{id}", srv.GetItem).Methods("GET")
-	api.HandleFunc("/items/{id}", srv.UpdateItem).Methods("PUT")
-	api.HandleFunc("/items/{id}", srv.DeleteItem).Methods("DELETE")
-	api.HandleFunc("/items/{id}/inventory", srv.UpdateInventory).Methods("PATCH")
+	// Start the job worker pool
+	jobManager := jobs.NewManager(jobs.NewMemoryStore(), jobs.Config{
+		Workers:   getIntEnvOrDefault("JOB_WORKERS", 2),
+		QueueSize: getIntEnvOrDefault("JOB_QUEUE_SIZE", 100),
+		Retention: getDurationEnvOrDefault("JOB_RETENTION", 24*time.Hour),
+		ResultDir: os.Getenv("JOB_RESULT_DIR"),
+	})
 
-	// Health check
-	r.HandleFunc("/health", srv.HealthCheck).Methods("GET")
+	// Create server
+	srv := server.NewServer(storeClient, server.Config{
+		Verifier:          verifier,
+		IdempotencyStore:  idempotency.NewMemoryStore(),
+		IdempotencyTTL:    getDurationEnvOrDefault("IDEMPOTENCY_TTL", 24*time.Hour),
+		BatchConcurrency:  getIntEnvOrDefault("BATCH_CONCURRENCY", 8),
+		Jobs:              jobManager,
+		CursorSecret:      []byte(os.Getenv("CURSOR_SECRET")),
+		RateLimiter:       ratelimit.NewMemoryLimiter(),
+		RateLimitPlans:    rateLimitPlans,
+		DefaultPlan:       getEnvOrDefault("RATE_LIMIT_DEFAULT_PLAN", "default"),
+		RateLimitByUser:   getBoolEnvOrDefault("RATE_LIMIT_BY_USER", false),
+		RateLimitByRoute:  getBoolEnvOrDefault("RATE_LIMIT_BY_ROUTE", false),
+		MaxRequestTimeout: getDurationEnvOrDefault("MAX_REQUEST_TIMEOUT", time.Minute),
+	})
 
-	// Metrics endpoint
-	r.Handle("/metrics", metrics.MetricsHandler()).Methods("GET")
+	// Setup routes
+	r := srv.Router()
 
 	// Setup CORS with X-Canary header support
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"}, // Configure this properly for production
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*", "X-Canary"},
-		ExposedHeaders:   []string{"X-Canary-Echo"},
+		ExposedHeaders:   []string{"X-Canary-Echo", "ETag", "Idempotent-Replayed", "Content-Disposition", "Location", "Retry-After", "Link", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Warning", "X-Stale", "Age"},
 		AllowCredentials: true,
 	})
 
@@ -117,6 +170,11 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	// Cancel running jobs once no new ones can be submitted
+	if err := jobManager.Stop(ctx); err != nil {
+		log.Printf("Failed to stop jobs: %v", err)
+	}
+
 	log.Println("API service stopped")
 }
 
@@ -126,3 +184,33 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDurationEnvOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s: %q, using %s", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getIntEnvOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s: %q, using %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getBoolEnvOrDefault(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid boolean for %s: %q, using %t", key, value, defaultValue)
+	}
+	return defaultValue
+}